@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage stored credentials of the remote",
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/spf13/cobra"
+)
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Store the password of the remote, reads it from stdin if it is not a terminal",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.LoadConfig()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		if p.Remote.Scheme() == project.SchemeSftp && p.Remote.Auth != project.AuthPassword {
+			return fmt.Errorf("auth method %s doesn't use a stored password", p.Remote.Auth)
+		}
+		if !p.Remote.UsesPassword() {
+			return fmt.Errorf("remote %s doesn't use a stored password", p.UserString())
+		}
+
+		if util.IsInteractive() {
+			if err := project.PasswordInteractive(&p); err != nil {
+				return errors.Join(errors.New("failed to get password interactively"), err)
+			}
+		} else {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return errors.Join(errors.New("failed to read password from stdin"), err)
+			}
+			p.Remote.Password = strings.TrimRight(line, "\r\n")
+		}
+
+		// make sure the remote can be reached before storing the password
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if err := p.StorePassword(); err != nil {
+			return errors.Join(errors.New("failed to store password"), err)
+		}
+
+		fmt.Printf("stored password for %s\n", p.UserString())
+
+		return nil
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLoginCmd)
+}
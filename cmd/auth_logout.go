@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/spf13/cobra"
+)
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the stored password of the remote",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.LoadConfig()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		if err := p.DeletePassword(); err != nil {
+			return errors.Join(errors.New("failed to remove password"), err)
+		}
+
+		fmt.Printf("removed password for %s\n", p.UserString())
+
+		return nil
+	},
+}
+
+func init() {
+	authCmd.AddCommand(authLogoutCmd)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <user@host:port/path|url> [dir]",
+	Short: "Clone an existing remote into a new directory",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rem, err := project.ParseRemote(args[0])
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to parse remote %s", args[0]), err)
+		}
+
+		dir := path.Base(rem.Path)
+		if len(args) > 1 {
+			dir = args[1]
+		} else if dir == "/" {
+			return fmt.Errorf("remote %s has no name to use as directory, specify the directory", args[0])
+		}
+
+		// ensure output directory is empty
+		if entries, err := os.ReadDir(dir); err != nil {
+			if !os.IsNotExist(err) {
+				return errors.Join(fmt.Errorf("failed to read directory %s", dir), err)
+			}
+		} else if len(entries) != 0 && !options.FlagForce {
+			return fmt.Errorf("directory %s is not empty, use --force to clone anyway", dir)
+		}
+
+		if rem.Auth, err = project.ParseAuthMethod(options.FlagAuth); err != nil {
+			return err
+		}
+		rem.Key = options.FlagKey
+		if rem.Scheme() == project.SchemeS3 {
+			rem.Endpoint = options.FlagEndpoint
+			rem.Region = options.FlagRegion
+			rem.Username = options.FlagAccessKey
+		}
+
+		p := project.Project{Version: project.Version, Remote: rem, EncryptionKeyFile: options.FlagKeyFile}
+
+		// credentials from the environment must not end up in the project file
+		creds := p
+		if err := creds.ResolveCredentials(); err != nil {
+			return errors.Join(fmt.Errorf("failed to get credentials for %s", p.UserString()), err)
+		}
+
+		r, err := remote.Connect(creds)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if empty, err := r.IsEmpty(); err != nil {
+			return errors.Join(errors.New("failed to check if remote directory is empty"), err)
+		} else if empty {
+			return fmt.Errorf("remote directory is empty, use `%s init` to create a new project", filepath.Base(os.Args[0]))
+		}
+
+		if p.Ignore, err = r.PullIgnore(); err != nil {
+			return errors.Join(errors.New("failed to pull ignore"), err)
+		}
+		r.Config = p
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			if !os.IsExist(err) {
+				return errors.Join(fmt.Errorf("failed to make directory %s", dir), err)
+			}
+		}
+		if err := os.Chdir(dir); err != nil {
+			return errors.Join(fmt.Errorf("failed to change directory into %s", dir), err)
+		}
+
+		// save project config
+		if err := project.Save(p); err != nil {
+			return errors.Join(errors.New("failed to save project file"), err)
+		}
+
+		if err := r.Clone(); err != nil {
+			return errors.Join(errors.New("failed to clone remote"), err)
+		}
+
+		// done
+		fmt.Printf("cloned %s into %s\n", p.UserString(), dir)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+	cloneCmd.Flags().StringVar(&options.FlagAuth, "auth", options.FlagAuth, "Auth method, one of password, key or agent")
+	cloneCmd.Flags().StringVar(&options.FlagKey, "key", options.FlagKey, "Private key file for the key auth method")
+	cloneCmd.Flags().StringVar(&options.FlagKeyFile, "key-file", options.FlagKeyFile, "Key file that unlocks an encrypted remote")
+	cloneCmd.Flags().StringVar(&options.FlagEndpoint, "endpoint", options.FlagEndpoint, "S3 compatible server of s3 remotes, empty for AWS")
+	cloneCmd.Flags().StringVar(&options.FlagRegion, "region", options.FlagRegion, "Region of s3 remotes")
+	cloneCmd.Flags().StringVar(&options.FlagAccessKey, "access-key", options.FlagAccessKey, "Access key of s3 remotes, empty to use the AWS environment variables or config files")
+}
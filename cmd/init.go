@@ -51,6 +51,11 @@ var (
 				return errors.Join(errors.New("failed to check if remote dir is empty"), err)
 			} else if !empty && !options.FlagForce {
 				return errors.New("remote directory is not empty, use --force to overwrite")
+			} else if empty && !r.IsEncrypted() {
+				if err := r.EnableEncryptionInteractive(); err != nil {
+					return errors.Join(errors.New("failed to set up encryption"), err)
+				}
+				p.EncryptionKeyFile = r.Config.EncryptionKeyFile
 			}
 
 			// save project config
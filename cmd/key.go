@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the encryption key of the remote",
+}
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+}
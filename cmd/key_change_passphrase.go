@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var keyChangePassphraseCmd = &cobra.Command{
+	Use:   "change-passphrase",
+	Short: "Change the passphrase or key file that unlocks the remote",
+	Long: `Change the passphrase or key file that unlocks the remote.
+
+This only re-wraps the master key, the data stays encrypted with the same keys.
+It does not revoke access: anyone who had the old passphrase, key file or a copy of the key on the remote
+can still decrypt everything that is and will be pushed. To revoke access, create a new remote and push to it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.LoadConfig()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		// credentials from the environment must not end up in the project file
+		creds := p
+		if err := creds.ResolveCredentials(); err != nil {
+			return errors.Join(fmt.Errorf("failed to get credentials for %s", p.UserString()), err)
+		}
+
+		r, err := remote.Connect(creds)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if !r.IsEncrypted() {
+			return errors.New("remote is not encrypted")
+		}
+
+		if err := r.ChangePassphraseInteractive(options.FlagKeyFile); err != nil {
+			return errors.Join(errors.New("failed to change passphrase"), err)
+		}
+
+		p.EncryptionKeyFile = r.Config.EncryptionKeyFile
+		if err := project.Save(p); err != nil {
+			return errors.Join(errors.New("failed to save project file"), err)
+		}
+
+		fmt.Println("changed passphrase, the old one no longer unlocks the remote but whoever knew it may have kept the master key")
+
+		return nil
+	},
+}
+
+func init() {
+	keyCmd.AddCommand(keyChangePassphraseCmd)
+	keyChangePassphraseCmd.Flags().StringVar(&options.FlagKeyFile, "key-file", options.FlagKeyFile, "Unlock the remote with this key file instead of a passphrase, it is created if it does not exist")
+}
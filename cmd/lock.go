@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var lockCmd = &cobra.Command{
+	Use:   "lock <path>...",
+	Short: "Lock files on the remote so nobody else can push them",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if options.FlagBreakStale {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if options.FlagBreakStale {
+			if err := r.BreakStalePushLock(); err != nil {
+				return errors.Join(errors.New("failed to break push lock"), err)
+			}
+			return nil
+		}
+
+		for _, arg := range args {
+			if err := r.Lock(paths.System(filepath.Clean(arg))); err != nil {
+				return errors.Join(fmt.Errorf("failed to lock %s", arg), err)
+			}
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.Flags().BoolVar(&options.FlagBreakStale, "break-stale", options.FlagBreakStale, "Remove the push lock of a crashed client instead of locking files")
+}
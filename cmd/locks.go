@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var locksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "List locked files on the remote",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if err := r.PrintLocks(); err != nil {
+			return errors.Join(errors.New("failed to list locks"), err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(locksCmd)
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log [path]",
+	Short: "List the commits on the remote or the versions of a file",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if len(args) == 0 {
+			if err := r.PrintCommits(); err != nil {
+				return errors.Join(errors.New("failed to get commits"), err)
+			}
+			return nil
+		}
+
+		if err := r.PrintHistory(paths.System(filepath.Clean(args[0]))); err != nil {
+			return errors.Join(fmt.Errorf("failed to get history of %s", args[0]), err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+}
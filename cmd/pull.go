@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:     "pull",
+	Aliases: []string{"update"},
+	Short:   "Pull remote changes into the local working tree",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if empty, err := r.IsEmpty(); err != nil {
+			return errors.Join(errors.New("failed to check if remote directory is empty"), err)
+		} else if empty {
+			return errors.New("remote directory is empty, nothing to pull")
+		}
+
+		if err := r.PullInteractive(); err != nil {
+			return errors.Join(errors.New("failed to pull from remote"), err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pullCmd)
+}
@@ -3,14 +3,18 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
 	"github.com/bloodmagesoftware/zet/internal/project"
 	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/bloodmagesoftware/zet/internal/util"
 	"github.com/spf13/cobra"
 )
 
 var pushCmd = &cobra.Command{
-	Use:     "push",
+	Use:     "push [<path>...]",
 	Aliases: []string{"commit"},
 	Short:   "Push local changes to remote",
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -33,6 +37,18 @@ var pushCmd = &cobra.Command{
 			} else {
 				return nil
 			}
+		} else if len(args) != 0 || options.FlagAll || options.FlagYes {
+			names := make([]paths.System, len(args))
+			for i, arg := range args {
+				names[i] = paths.System(filepath.Clean(arg))
+			}
+			if err := r.CommitPaths(names); err != nil {
+				return errors.Join(errors.New("failed to push to remote"), err)
+			} else {
+				return nil
+			}
+		} else if !util.IsInteractive() {
+			return errors.New("stdin is not a terminal, use --all or pass paths to push without selecting changes interactively")
 		} else {
 			if err := r.CommitInteractive(); err != nil {
 				return errors.Join(errors.New("failed to push to remote"), err)
@@ -45,4 +61,9 @@ var pushCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(pushCmd)
+	pushCmd.Flags().StringVarP(&options.FlagMessage, "message", "m", options.FlagMessage, "Commit message")
+	pushCmd.Flags().BoolVarP(&options.FlagAll, "all", "a", options.FlagAll, "Push all changes without selecting them interactively")
+	pushCmd.Flags().BoolVarP(&options.FlagYes, "yes", "y", options.FlagYes, "Push the given paths or all changes without asking")
+	pushCmd.Flags().BoolVar(&options.FlagOnlyAdded, "only-added", options.FlagOnlyAdded, "Only push files that don't exist on the remote yet")
+	pushCmd.Flags().BoolVar(&options.FlagNoDeletes, "no-deletes", options.FlagNoDeletes, "Don't push deleted files")
 }
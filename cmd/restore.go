@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "Restore a version of a file from the remote into the working tree",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if err := r.Restore(paths.System(filepath.Clean(args[0])), options.FlagVersion); err != nil {
+			return errors.Join(fmt.Errorf("failed to restore %s", args[0]), err)
+		}
+
+		fmt.Printf("use `%s push` to make the restored file the current version on the remote\n", filepath.Base(os.Args[0]))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().IntVar(&options.FlagVersion, "version", options.FlagVersion, "Version to restore, defaults to the latest one")
+}
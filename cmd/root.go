@@ -21,5 +21,8 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&options.FlagForce, "force", "f", options.FlagForce, "Enforce a destructive action")
+	rootCmd.PersistentFlags().BoolVar(&options.FlagAcceptNewHostKey, "accept-new-hostkey", options.FlagAcceptNewHostKey, "Trust unknown and changed host keys of the remote without asking")
 	rootCmd.PersistentFlags().BoolVarP(&options.FlagVerbose, "verbose", "v", options.FlagVerbose, "Write additional output to stdout")
+	rootCmd.PersistentFlags().DurationVar(&options.FlagWait, "wait", options.FlagWait, "How long to wait for another client to finish changing the remote")
+	rootCmd.PersistentFlags().IntVarP(&options.FlagJobs, "jobs", "j", options.FlagJobs, "Number of files to transfer concurrently")
 }
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/remote"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"st"},
+	Short:   "Show differences between the local working tree and the remote",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := project.Load()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to open project file %s", project.ProjectFileName), err)
+		}
+
+		r, err := remote.Connect(p)
+		if err != nil {
+			return errors.Join(errors.New("failed to connect to remote"), err)
+		}
+		defer r.Close()
+
+		if err := r.Status(); err != nil {
+			return errors.Join(errors.New("failed to get status"), err)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&options.FlagPorcelain, "porcelain", options.FlagPorcelain, "Write machine readable output in the form XY <path>, X being the local and Y the remote change")
+	statusCmd.Flags().BoolVar(&options.FlagJson, "json", options.FlagJson, "Write machine readable output as JSON")
+	statusCmd.MarkFlagsMutuallyExclusive("porcelain", "json")
+}
@@ -0,0 +1,232 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Codec byte
+
+const (
+	CodecNone Codec = iota
+	CodecGzip
+	CodecZstd
+)
+
+func (c Codec) ToString() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecGzip:
+		return "gzip"
+	case CodecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("codec %d", c)
+	}
+}
+
+// magic starts every blob that records its codec in the byte that follows.
+// Blobs of older clients have no header and are always gzip.
+var magic = []byte("ZETB")
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Policy decides how a file is compressed.
+type Policy struct {
+	Codec Codec
+	// Level is the codec specific level, 0 for its default
+	Level int
+	// Auto picks between zstd and no compression depending on how well the content compresses
+	Auto bool
+}
+
+// DefaultPolicy skips compression for content that doesn't get smaller.
+var DefaultPolicy = Policy{Codec: CodecZstd, Auto: true}
+
+// ParsePolicy parses a policy in the form auto, none, gzip, gzip-<level>, zstd or zstd-<level>.
+func ParsePolicy(s string) (Policy, error) {
+	name, levelStr, hasLevel := strings.Cut(strings.TrimSpace(s), "-")
+
+	var p Policy
+	maxLevel := 0
+	switch name {
+	case "auto":
+		p = DefaultPolicy
+	case "none":
+		p = Policy{Codec: CodecNone}
+	case "gzip":
+		p = Policy{Codec: CodecGzip}
+		maxLevel = gzip.BestCompression
+	case "zstd":
+		p = Policy{Codec: CodecZstd}
+		maxLevel = 22
+	default:
+		return p, fmt.Errorf("unknown compression %s, expected auto, none, gzip, gzip-<level>, zstd or zstd-<level>", s)
+	}
+
+	if hasLevel {
+		level, err := strconv.Atoi(levelStr)
+		if err != nil || maxLevel == 0 || level < 1 || level > maxLevel {
+			return p, fmt.Errorf("invalid compression level in %s, %s supports levels 1-%d", s, name, maxLevel)
+		}
+		p.Level = level
+	}
+
+	return p, nil
+}
+
+func (p Policy) ToString() string {
+	switch {
+	case p.Auto:
+		return "auto"
+	case p.Level != 0:
+		return fmt.Sprintf("%s-%d", p.Codec.ToString(), p.Level)
+	default:
+		return p.Codec.ToString()
+	}
+}
+
+func (p Policy) MarshalText() ([]byte, error) {
+	return []byte(p.ToString()), nil
+}
+
+func (p *Policy) UnmarshalText(b []byte) error {
+	var err error
+	*p, err = ParsePolicy(string(b))
+	return err
+}
+
+// autoSampleSize is how much of the content is compressed to decide if compression is worth it
+const autoSampleSize = 1 << 20
+
+// Resolve replaces an automatic policy with the one to use for the content that r reads.
+// Compression is skipped if it saves less than 3% of the first MiB.
+func (p Policy) Resolve(r io.Reader) (Policy, error) {
+	if !p.Auto {
+		return p, nil
+	}
+
+	sample, err := io.ReadAll(io.LimitReader(r, autoSampleSize))
+	if err != nil {
+		return p, err
+	}
+	if len(sample) == 0 {
+		return Policy{Codec: CodecNone}, nil
+	}
+
+	var compressed countWriter
+	zw, err := newZstdWriter(&compressed, p.Level)
+	if err != nil {
+		return p, err
+	}
+	if _, err := zw.Write(sample); err != nil {
+		return p, err
+	}
+	if err := zw.Close(); err != nil {
+		return p, err
+	}
+
+	if compressed.n*100 >= int64(len(sample))*97 {
+		return Policy{Codec: CodecNone}, nil
+	}
+	return Policy{Codec: p.Codec, Level: p.Level}, nil
+}
+
+// NewWriter writes the header of the blob and returns a writer that compresses into w.
+// The output only depends on the written bytes and the policy, so interrupted uploads can recreate it.
+// Close the returned writer to flush the compressed stream, it does not close w.
+func NewWriter(w io.Writer, p Policy) (io.WriteCloser, error) {
+	if p.Auto {
+		return nil, errors.New("automatic compression policy must be resolved first")
+	}
+
+	if _, err := w.Write(append(bytes.Clone(magic), byte(p.Codec))); err != nil {
+		return nil, err
+	}
+
+	switch p.Codec {
+	case CodecNone:
+		return nopWriteCloser{w}, nil
+	case CodecGzip:
+		level := p.Level
+		if level == 0 {
+			level = gzip.BestCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CodecZstd:
+		return newZstdWriter(w, p.Level)
+	default:
+		return nil, fmt.Errorf("unknown compression %s", p.Codec.ToString())
+	}
+}
+
+func newZstdWriter(w io.Writer, level int) (*zstd.Encoder, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != 0 {
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	// a single goroutine keeps the output deterministic
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+}
+
+// NewReader returns a reader that decompresses the blob that r reads, whatever codec it uses.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.Peek(len(magic) + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(header, gzipMagic) {
+		return gzip.NewReader(br)
+	}
+	if len(header) != len(magic)+1 || !bytes.Equal(header[:len(magic)], magic) {
+		return nil, errors.New("blob has an unknown format")
+	}
+	if _, err := br.Discard(len(header)); err != nil {
+		return nil, err
+	}
+
+	switch codec := Codec(header[len(magic)]); codec {
+	case CodecNone:
+		return io.NopCloser(br), nil
+	case CodecGzip:
+		return gzip.NewReader(br)
+	case CodecZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("blob uses unknown %s", codec.ToString())
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
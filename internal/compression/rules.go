@@ -0,0 +1,81 @@
+package compression
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"gopkg.in/yaml.v3"
+)
+
+type Rule struct {
+	Pattern string
+	Policy  Policy
+}
+
+// Rules map gitignore style patterns to compression policies.
+// They keep the order of the project file, because later rules override earlier ones.
+// Patterns starting with * have to be quoted, otherwise YAML reads them as aliases:
+//
+//	compression:
+//	  "*.png": none
+//	  "assets/**/*.wav": zstd-19
+//	  docs/: gzip
+type Rules []Rule
+
+func (rs *Rules) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return errors.New("compression must be a mapping of patterns to compression policies")
+	}
+
+	*rs = make(Rules, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		r := Rule{Pattern: node.Content[i].Value}
+		if err := r.Policy.UnmarshalText([]byte(node.Content[i+1].Value)); err != nil {
+			return errors.Join(fmt.Errorf("invalid compression for pattern %s in line %d", r.Pattern, node.Content[i].Line), err)
+		}
+		*rs = append(*rs, r)
+	}
+
+	return nil
+}
+
+func (rs Rules) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, r := range rs {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: r.Pattern},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: r.Policy.ToString()},
+		)
+	}
+	return node, nil
+}
+
+type Matcher struct {
+	patterns []gitignore.Pattern
+	policies []Policy
+}
+
+func (rs Rules) Matcher() Matcher {
+	m := Matcher{
+		patterns: make([]gitignore.Pattern, len(rs)),
+		policies: make([]Policy, len(rs)),
+	}
+	for i, r := range rs {
+		m.patterns[i] = gitignore.ParsePattern(r.Pattern, nil)
+		m.policies[i] = r.Policy
+	}
+	return m
+}
+
+// Policy returns the policy of the last rule matching name, or DefaultPolicy.
+func (m Matcher) Policy(name paths.Path) Policy {
+	gitPath := name.ToGit()
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		if m.patterns[i].Match(gitPath, false) == gitignore.Exclude {
+			return m.policies[i]
+		}
+	}
+	return DefaultPolicy
+}
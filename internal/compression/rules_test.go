@@ -0,0 +1,62 @@
+package compression
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"gopkg.in/yaml.v3"
+)
+
+// rulesExample is the example of the documentation of Rules.
+const rulesExample = `compression:
+  "*.png": none
+  "assets/**/*.wav": zstd-19
+  docs/: gzip
+`
+
+type rulesFile struct {
+	Compression Rules `yaml:"compression"`
+}
+
+func TestRulesExample(t *testing.T) {
+	var f rulesFile
+	if err := yaml.Unmarshal([]byte(rulesExample), &f); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Rules{
+		{Pattern: "*.png", Policy: Policy{Codec: CodecNone}},
+		{Pattern: "assets/**/*.wav", Policy: Policy{Codec: CodecZstd, Level: 19}},
+		{Pattern: "docs/", Policy: Policy{Codec: CodecGzip}},
+	}
+	if !slices.Equal(f.Compression, want) {
+		t.Fatalf("got %v, want %v", f.Compression, want)
+	}
+
+	m := f.Compression.Matcher()
+	for name, policy := range map[paths.Unix]Policy{
+		"textures/a.png":       {Codec: CodecNone},
+		"assets/sfx/boom.wav":  {Codec: CodecZstd, Level: 19},
+		"docs/readme.txt":      {Codec: CodecGzip},
+		"levels/level1.map":    DefaultPolicy,
+		"assets/sfx/boom.flac": DefaultPolicy,
+	} {
+		if got := m.Policy(name); got != policy {
+			t.Errorf("%s: got %s, want %s", name, got.ToString(), policy.ToString())
+		}
+	}
+
+	// writing the rules back gives a file that can be read again
+	b, err := yaml.Marshal(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again rulesFile
+	if err := yaml.Unmarshal(b, &again); err != nil {
+		t.Fatalf("failed to read written rules %q: %s", b, err)
+	}
+	if !slices.Equal(again.Compression, want) {
+		t.Fatalf("read back %v, want %v", again.Compression, want)
+	}
+}
@@ -0,0 +1,168 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// blobMagic starts every encrypted blob, the salt of the blob follows it.
+var blobMagic = []byte("ZETS")
+
+// BlobSaltSize is the size of the random salt every blob key is derived with.
+const BlobSaltSize = 16
+
+// chunkSize is the size of the plaintext chunks a blob is encrypted in, so it can be streamed.
+const chunkSize = 64 << 10
+
+// blobOverhead is the size of the tag GCM adds to every chunk.
+const blobOverhead = 16
+
+// NewBlobSalt returns a new random salt for NewBlobWriter.
+func NewBlobSalt() []byte {
+	salt := make([]byte, BlobSaltSize)
+	_, _ = rand.Read(salt)
+	return salt
+}
+
+// blobAead returns the cipher of the blob with the given object id and salt.
+// The compressed content of an object is not fixed by its hash, so every upload needs its own salt,
+// then every blob has its own key and the nonces only have to be unique within a blob.
+func (k *Key) blobAead(objectID, salt []byte) (cipher.AEAD, error) {
+	if len(salt) != BlobSaltSize {
+		return nil, fmt.Errorf("blob salt has %d bytes instead of %d", len(salt), BlobSaltSize)
+	}
+	return newAead(mac(mac(k.blobs, objectID), salt))
+}
+
+// chunkNonce numbers the chunks and marks the last one, so chunks can't be reordered or cut off.
+func chunkNonce(aead cipher.AEAD, counter uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// NewBlobWriter encrypts everything written to it into w.
+// The output only depends on the key, the object id, the salt and the written bytes,
+// so interrupted uploads can recreate it with the same salt. Every new upload must use a new salt from NewBlobSalt.
+// Close the returned writer to write the last chunk, it does not close w.
+func (k *Key) NewBlobWriter(w io.Writer, objectID, salt []byte) (io.WriteCloser, error) {
+	aead, err := k.blobAead(objectID, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(blobMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &blobWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+type blobWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (bw *blobWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) != 0 {
+		// a full chunk is only written once more data follows, the last chunk is written by Close
+		if len(bw.buf) == chunkSize {
+			if err := bw.writeChunk(false); err != nil {
+				return 0, err
+			}
+		}
+		k := copy(bw.buf[len(bw.buf):cap(bw.buf)], p)
+		bw.buf = bw.buf[:len(bw.buf)+k]
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (bw *blobWriter) Close() error {
+	if bw.closed {
+		return nil
+	}
+	bw.closed = true
+	return bw.writeChunk(true)
+}
+
+func (bw *blobWriter) writeChunk(last bool) error {
+	sealed := bw.aead.Seal(nil, chunkNonce(bw.aead, bw.counter, last), bw.buf, nil)
+	bw.counter++
+	bw.buf = bw.buf[:0]
+	_, err := bw.w.Write(sealed)
+	return err
+}
+
+// NewBlobReader decrypts the blob with the given object id that r reads.
+func (k *Key) NewBlobReader(r io.Reader, objectID []byte) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, chunkSize+blobOverhead)
+	header := make([]byte, len(blobMagic)+BlobSaltSize)
+	if _, err := io.ReadFull(br, header); err != nil || !bytes.Equal(header[:len(blobMagic)], blobMagic) {
+		return nil, errors.New("blob is not encrypted")
+	}
+
+	aead, err := k.blobAead(objectID, header[len(blobMagic):])
+	if err != nil {
+		return nil, err
+	}
+
+	return &blobReader{r: br, aead: aead, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+type blobReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+func (br *blobReader) Read(p []byte) (int, error) {
+	for len(br.plain) == 0 {
+		if br.done {
+			return 0, io.EOF
+		}
+		if err := br.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, br.plain)
+	br.plain = br.plain[n:]
+	return n, nil
+}
+
+func (br *blobReader) readChunk() error {
+	n, err := io.ReadFull(br.r, br.chunk)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	// the last chunk is the one nothing follows
+	_, peekErr := br.r.Peek(1)
+	last := errors.Is(peekErr, io.EOF)
+
+	plain, err := br.aead.Open(br.chunk[:0], chunkNonce(br.aead, br.counter, last), br.chunk[:n], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	br.counter++
+	br.plain = plain
+	br.done = last
+	return nil
+}
@@ -0,0 +1,192 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKey(t *testing.T) *Key {
+	t.Helper()
+
+	k, err := NewKey(NewMasterKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// blobHeaderSize is the size of the magic and the salt before the first chunk.
+const blobHeaderSize = len("ZETS") + BlobSaltSize
+
+func sealBlob(t *testing.T, k *Key, objectID, plain []byte) []byte {
+	t.Helper()
+
+	return sealBlobWithSalt(t, k, objectID, NewBlobSalt(), plain)
+}
+
+func sealBlobWithSalt(t *testing.T, k *Key, objectID, salt, plain []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := k.NewBlobWriter(&buf, objectID, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openBlob(k *Key, objectID, sealed []byte) ([]byte, error) {
+	r, err := k.NewBlobReader(bytes.NewReader(sealed), objectID)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestBlobRoundTrip(t *testing.T) {
+	k := testKey(t)
+	objectID := []byte("object")
+
+	// empty, within one chunk, exactly at and around chunk boundaries and several chunks
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+
+		sealed := sealBlob(t, k, objectID, plain)
+		// a full last chunk is written by Close, not followed by an empty one
+		chunks := max(1, (size+chunkSize-1)/chunkSize)
+		if want := blobHeaderSize + size + chunks*16; len(sealed) != want {
+			t.Errorf("%d bytes: sealed to %d bytes, want %d", size, len(sealed), want)
+		}
+
+		got, err := openBlob(k, objectID, sealed)
+		if err != nil {
+			t.Fatalf("%d bytes: %s", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("%d bytes: round trip changed the content", size)
+		}
+	}
+}
+
+func TestBlobDeterministic(t *testing.T) {
+	k := testKey(t)
+	plain := bytes.Repeat([]byte("zet"), chunkSize)
+	salt := NewBlobSalt()
+
+	// resumed uploads recreate the blob with the salt they started with
+	if !bytes.Equal(sealBlobWithSalt(t, k, []byte("object"), salt, plain), sealBlobWithSalt(t, k, []byte("object"), salt, plain)) {
+		t.Fatal("the same content and salt sealed to different blobs")
+	}
+	if bytes.Equal(sealBlobWithSalt(t, k, []byte("object"), salt, plain), sealBlobWithSalt(t, k, []byte("other"), salt, plain)) {
+		t.Fatal("different objects sealed to the same blob")
+	}
+}
+
+func TestBlobSalt(t *testing.T) {
+	k := testKey(t)
+	objectID := []byte("object")
+	plain := bytes.Repeat([]byte("zet"), chunkSize)
+
+	// every upload of an object gets its own key, different compressed bytes must never share a key and nonce
+	first, second := sealBlob(t, k, objectID, plain), sealBlob(t, k, objectID, plain)
+	if bytes.Equal(first[blobHeaderSize:], second[blobHeaderSize:]) {
+		t.Fatal("uploads of the same object were sealed with the same key")
+	}
+	for _, sealed := range [][]byte{first, second} {
+		if got, err := openBlob(k, objectID, sealed); err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("failed to open a salted blob: %v", err)
+		}
+	}
+
+	// the salt is authenticated through the key
+	sealed := bytes.Clone(first)
+	sealed[len(blobMagic)] ^= 1
+	if _, err := openBlob(k, objectID, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened a blob with a modified salt: %v", err)
+	}
+
+	if _, err := k.NewBlobWriter(io.Discard, objectID, nil); err == nil {
+		t.Fatal("sealed a blob without salt")
+	}
+}
+
+func TestBlobWrongObject(t *testing.T) {
+	k := testKey(t)
+	sealed := sealBlob(t, k, []byte("object"), []byte("content"))
+
+	if _, err := openBlob(k, []byte("other"), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened with another object id: %v", err)
+	}
+	if _, err := openBlob(testKey(t), []byte("object"), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened with another key: %v", err)
+	}
+}
+
+func TestBlobTruncated(t *testing.T) {
+	k := testKey(t)
+	objectID := []byte("object")
+	plain := make([]byte, 3*chunkSize+17)
+	_, _ = rand.Read(plain)
+	sealed := sealBlob(t, k, objectID, plain)
+	sealedChunk := chunkSize + 16
+
+	// cutting off whole chunks makes a full chunk the last one, which was not sealed as the last one
+	for chunks := 1; chunks <= 3; chunks++ {
+		cut := sealed[:blobHeaderSize+chunks*sealedChunk]
+		if _, err := openBlob(k, objectID, cut); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("cut after %d chunks: %v", chunks, err)
+		}
+	}
+
+	// cutting into a chunk breaks its tag
+	if _, err := openBlob(k, objectID, sealed[:len(sealed)-1]); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("cut into the last chunk: %v", err)
+	}
+}
+
+func TestBlobLastChunkFlag(t *testing.T) {
+	k := testKey(t)
+	objectID := []byte("object")
+
+	// a blob whose only chunk is not marked as the last one, as if the chunks after it were cut off
+	salt := NewBlobSalt()
+	aead, err := k.blobAead(objectID, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := append(append(bytes.Clone(blobMagic), salt...), aead.Seal(nil, chunkNonce(aead, 0, false), []byte("content"), nil)...)
+	if _, err := openBlob(k, objectID, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened a blob without last chunk: %v", err)
+	}
+
+	// data appended after the last chunk
+	sealed = append(sealBlobWithSalt(t, k, objectID, salt, []byte("content")), sealBlobWithSalt(t, k, objectID, salt, []byte("more"))[blobHeaderSize:]...)
+	if _, err := openBlob(k, objectID, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened a blob with data after the last chunk: %v", err)
+	}
+}
+
+func TestBlobModified(t *testing.T) {
+	k := testKey(t)
+	objectID := []byte("object")
+	sealed := sealBlob(t, k, objectID, []byte("content"))
+
+	sealed[blobHeaderSize] ^= 1
+	if _, err := openBlob(k, objectID, sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened a modified blob: %v", err)
+	}
+
+	if _, err := openBlob(k, objectID, []byte("plain content")); err == nil {
+		t.Fatal("opened an unencrypted blob")
+	}
+}
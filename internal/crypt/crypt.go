@@ -0,0 +1,173 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of the master key and all keys derived from it.
+const KeySize = 32
+
+// maxNameLength is the longest file name most file systems support.
+const maxNameLength = 255
+
+// fileMagic starts every encrypted file that is not a blob.
+var fileMagic = []byte("ZETF")
+
+var nameEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// ErrDecrypt means the data was not encrypted with this key or was modified.
+var ErrDecrypt = errors.New("failed to decrypt, wrong key or modified data")
+
+// Key encrypts the content and names of a remote, all of its keys are derived from one master key.
+type Key struct {
+	master []byte
+	// files encrypts small remote files like metas and commits
+	files cipher.AEAD
+	// names encrypts path components, nameIVs makes that deterministic
+	names   cipher.AEAD
+	nameIVs []byte
+	// objects names objects without revealing the hash of their content
+	objects []byte
+	// blobs derives the key of each blob
+	blobs []byte
+}
+
+// NewMasterKey returns a new random master key.
+func NewMasterKey() []byte {
+	master := make([]byte, KeySize)
+	_, _ = rand.Read(master)
+	return master
+}
+
+func NewKey(master []byte) (*Key, error) {
+	if len(master) != KeySize {
+		return nil, fmt.Errorf("master key has %d bytes instead of %d", len(master), KeySize)
+	}
+
+	derive := func(info string) ([]byte, error) {
+		return hkdf.Key(sha256.New, master, nil, "zet "+info, KeySize)
+	}
+
+	k := &Key{master: bytes.Clone(master)}
+
+	filesKey, err := derive("files")
+	if err != nil {
+		return nil, err
+	}
+	if k.files, err = newAead(filesKey); err != nil {
+		return nil, err
+	}
+
+	namesKey, err := derive("names")
+	if err != nil {
+		return nil, err
+	}
+	if k.names, err = newAead(namesKey); err != nil {
+		return nil, err
+	}
+	if k.nameIVs, err = derive("name ivs"); err != nil {
+		return nil, err
+	}
+	if k.objects, err = derive("objects"); err != nil {
+		return nil, err
+	}
+	if k.blobs, err = derive("blobs"); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Master returns the master key, only to wrap it with another key.
+func (k *Key) Master() []byte {
+	return bytes.Clone(k.master)
+}
+
+// ObjectID names the object of the content with the given hash.
+func (k *Key) ObjectID(contentHash []byte) []byte {
+	return mac(k.objects, contentHash)
+}
+
+// SealFile encrypts a small file, name is authenticated so the file can't be swapped with another one.
+func (k *Key) SealFile(name string, plain []byte) []byte {
+	nonce := make([]byte, k.files.NonceSize())
+	_, _ = rand.Read(nonce)
+
+	out := make([]byte, 0, len(fileMagic)+len(nonce)+len(plain)+k.files.Overhead())
+	out = append(out, fileMagic...)
+	out = append(out, nonce...)
+	return k.files.Seal(out, nonce, plain, []byte(name))
+}
+
+// OpenFile decrypts a file encrypted with SealFile under the same name.
+func (k *Key) OpenFile(name string, sealed []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(sealed, fileMagic)
+	if !ok || len(rest) < k.files.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	nonce, ciphertext := rest[:k.files.NonceSize()], rest[k.files.NonceSize():]
+	plain, err := k.files.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// EncryptPath encrypts every component of a slash separated path on its own, so the result is a valid path again.
+// Equal paths always give equal results, otherwise files could not be found by their name.
+func (k *Key) EncryptPath(p string) (string, error) {
+	components := strings.Split(p, "/")
+	for i, component := range components {
+		iv := mac(k.nameIVs, []byte(component))[:k.names.NonceSize()]
+		sealed := k.names.Seal(bytes.Clone(iv), iv, []byte(component), nil)
+		encoded := strings.ToLower(nameEncoding.EncodeToString(sealed))
+		if len(encoded) > maxNameLength {
+			return "", fmt.Errorf("name %s is too long for an encrypted remote", component)
+		}
+		components[i] = encoded
+	}
+	return strings.Join(components, "/"), nil
+}
+
+// DecryptPath reverses EncryptPath.
+func (k *Key) DecryptPath(p string) (string, error) {
+	components := strings.Split(p, "/")
+	for i, component := range components {
+		sealed, err := nameEncoding.DecodeString(strings.ToUpper(component))
+		if err != nil || len(sealed) < k.names.NonceSize() {
+			return "", ErrDecrypt
+		}
+		iv := sealed[:k.names.NonceSize()]
+		plain, err := k.names.Open(nil, iv, sealed[k.names.NonceSize():], nil)
+		if err != nil || !hmac.Equal(mac(k.nameIVs, plain)[:len(iv)], iv) {
+			return "", ErrDecrypt
+		}
+		components[i] = string(plain)
+	}
+	return strings.Join(components, "/"), nil
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func mac(key []byte, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewKeySize(t *testing.T) {
+	if _, err := NewKey(make([]byte, KeySize-1)); err == nil {
+		t.Fatal("accepted a short master key")
+	}
+}
+
+func TestNewKeyDeterministic(t *testing.T) {
+	master := NewMasterKey()
+	a, err := NewKey(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKey(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := []byte("content hash")
+	if !bytes.Equal(a.ObjectID(hash), b.ObjectID(hash)) {
+		t.Fatal("the same master key gave different object ids")
+	}
+	if bytes.Equal(a.ObjectID(hash), testKey(t).ObjectID(hash)) {
+		t.Fatal("different master keys gave the same object id")
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	k := testKey(t)
+	plain := []byte(`{"version":1}`)
+
+	sealed := k.SealFile("meta/a.txt", plain)
+	if bytes.Contains(sealed, plain) {
+		t.Fatal("sealed file contains the plain text")
+	}
+	got, err := k.OpenFile("meta/a.txt", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("got %q, want %q", got, plain)
+	}
+
+	// files are swapped by renaming them on the remote
+	if _, err := k.OpenFile("meta/b.txt", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened under another name: %v", err)
+	}
+	if _, err := testKey(t).OpenFile("meta/a.txt", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened with another key: %v", err)
+	}
+	if _, err := k.OpenFile("meta/a.txt", sealed[:len(sealed)-1]); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened a truncated file: %v", err)
+	}
+	if _, err := k.OpenFile("meta/a.txt", plain); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("opened an unencrypted file: %v", err)
+	}
+}
+
+func TestPathRoundTrip(t *testing.T) {
+	k := testKey(t)
+
+	for _, p := range []string{"a.txt", "dir/sub/c.txt", "Ünïcode/名前.txt", "with space/.hidden"} {
+		encrypted, err := k.EncryptPath(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Count(encrypted, "/") != strings.Count(p, "/") {
+			t.Errorf("%s: encrypted to %s, which has other components", p, encrypted)
+		}
+		if encrypted != strings.ToLower(encrypted) {
+			t.Errorf("%s: encrypted to %s, which breaks on case insensitive file systems", p, encrypted)
+		}
+
+		got, err := k.DecryptPath(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != p {
+			t.Errorf("got %s, want %s", got, p)
+		}
+	}
+}
+
+func TestPathDeterministic(t *testing.T) {
+	k := testKey(t)
+
+	a, err := k.EncryptPath("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := k.EncryptPath("dir/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := k.EncryptPath("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a != again {
+		t.Fatalf("the same path encrypted to %s and %s", a, again)
+	}
+	// equal directories are equal on the remote, so files of a directory stay together
+	if dirA, dirB := strings.Split(a, "/")[0], strings.Split(b, "/")[0]; dirA != dirB {
+		t.Fatalf("the same directory encrypted to %s and %s", dirA, dirB)
+	}
+	if a == b {
+		t.Fatal("different paths encrypted to the same path")
+	}
+
+	other, err := testKey(t).EncryptPath("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == a {
+		t.Fatal("different keys encrypted to the same path")
+	}
+}
+
+func TestPathModified(t *testing.T) {
+	k := testKey(t)
+
+	encrypted, err := k.EncryptPath("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testKey(t).DecryptPath(encrypted); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("decrypted with another key: %v", err)
+	}
+	if _, err := k.DecryptPath("a.txt"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("decrypted a plain path: %v", err)
+	}
+}
+
+func TestPathTooLong(t *testing.T) {
+	if _, err := testKey(t).EncryptPath(strings.Repeat("a", maxNameLength)); err == nil {
+		t.Fatal("encrypted a name that is too long for the remote")
+	}
+}
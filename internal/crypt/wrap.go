@@ -0,0 +1,121 @@
+package crypt
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type KDF string
+
+const (
+	// KDFPassphrase derives the wrapping key from a passphrase with argon2id
+	KDFPassphrase KDF = "argon2id"
+	// KDFKeyFile derives the wrapping key from the content of a key file
+	KDFKeyFile KDF = "keyfile"
+)
+
+// argon2 parameters for passphrases, as recommended by RFC 9106 for memory constrained environments
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 << 10
+	argon2Threads = 4
+)
+
+// minKeyFileSize makes sure key files have at least as much entropy as the master key.
+const minKeyFileSize = KeySize
+
+// Wrapped is the master key encrypted with a key derived from a passphrase or key file.
+// It is stored unencrypted on the remote, so changing the passphrase doesn't require encrypting everything again.
+type Wrapped struct {
+	KDF     KDF    `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	Key     []byte `json:"key"`
+}
+
+// Wrap encrypts the master key of k with the secret, which is a passphrase or the content of a key file.
+func (k *Key) Wrap(kdf KDF, secret []byte) (Wrapped, error) {
+	w := Wrapped{KDF: kdf, Salt: make([]byte, 16)}
+	_, _ = rand.Read(w.Salt)
+	if kdf == KDFPassphrase {
+		w.Time, w.Memory, w.Threads = argon2Time, argon2Memory, argon2Threads
+	}
+
+	aead, err := w.aead(secret)
+	if err != nil {
+		return w, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	w.Key = aead.Seal(nonce, nonce, k.master, []byte(w.KDF))
+
+	return w, nil
+}
+
+// Unwrap decrypts the master key with the secret and returns the key of the remote.
+func (w Wrapped) Unwrap(secret []byte) (*Key, error) {
+	aead, err := w.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(w.Key) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	master, err := aead.Open(nil, w.Key[:aead.NonceSize()], w.Key[aead.NonceSize():], []byte(w.KDF))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return NewKey(master)
+}
+
+func (w Wrapped) aead(secret []byte) (cipher.AEAD, error) {
+	switch w.KDF {
+	case KDFPassphrase:
+		if len(secret) == 0 {
+			return nil, errors.New("passphrase is empty")
+		}
+		// argon2 panics on these, the wrapped key is read from the remote and may have been modified
+		if w.Time < 1 || w.Threads < 1 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		return newAead(argon2.IDKey(secret, w.Salt, w.Time, w.Memory, w.Threads, KeySize))
+	case KDFKeyFile:
+		if len(secret) < minKeyFileSize {
+			return nil, fmt.Errorf("key file has %d bytes, at least %d are required", len(secret), minKeyFileSize)
+		}
+		return newAead(mac(w.Salt, secret))
+	default:
+		return nil, fmt.Errorf("unknown key derivation %s", w.KDF)
+	}
+}
+
+func ReadKeyFile(name string) ([]byte, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read key file %s", name), err)
+	}
+	return b, nil
+}
+
+// CreateKeyFile reads a key file, creating it with random content if it does not exist.
+func CreateKeyFile(name string) ([]byte, error) {
+	if _, err := os.Stat(name); err == nil {
+		return ReadKeyFile(name)
+	}
+
+	b := NewMasterKey()
+	if err := os.WriteFile(name, b, 0600); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to write key file %s", name), err)
+	}
+	return b, nil
+}
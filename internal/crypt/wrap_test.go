@@ -0,0 +1,142 @@
+package crypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrapRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		kdf    KDF
+		secret []byte
+		wrong  []byte
+	}{
+		{KDFPassphrase, []byte("correct horse battery staple"), []byte("wrong horse battery staple")},
+		{KDFKeyFile, bytes.Repeat([]byte{1}, minKeyFileSize), bytes.Repeat([]byte{2}, minKeyFileSize)},
+	} {
+		t.Run(string(tc.kdf), func(t *testing.T) {
+			k := testKey(t)
+
+			w, err := k.Wrap(tc.kdf, tc.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the wrapped key is stored as json on the remote
+			b, err := json.Marshal(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded Wrapped
+			if err := json.Unmarshal(b, &loaded); err != nil {
+				t.Fatal(err)
+			}
+
+			unwrapped, err := loaded.Unwrap(tc.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(unwrapped.Master(), k.Master()) {
+				t.Fatal("unwrapped another master key")
+			}
+
+			if _, err := loaded.Unwrap(tc.wrong); !errors.Is(err, ErrDecrypt) {
+				t.Fatalf("unwrapped with a wrong secret: %v", err)
+			}
+
+			// the derivation is authenticated, so it can't be downgraded
+			loaded.KDF = KDFKeyFile
+			if tc.kdf == KDFKeyFile {
+				loaded.KDF = KDFPassphrase
+			}
+			if _, err := loaded.Unwrap(tc.secret); err == nil {
+				t.Fatal("unwrapped with another key derivation")
+			}
+		})
+	}
+}
+
+func TestWrapRewrap(t *testing.T) {
+	k := testKey(t)
+
+	old, err := k.Wrap(KDFPassphrase, []byte("old passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, err := k.Wrap(KDFPassphrase, []byte("new passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rewrapped.Unwrap([]byte("old passphrase")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("the old passphrase unwrapped the rewrapped key: %v", err)
+	}
+	// changing the passphrase only wraps the same master key again
+	a, err := old.Unwrap([]byte("old passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := rewrapped.Unwrap([]byte("new passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Master(), b.Master()) {
+		t.Fatal("changing the passphrase changed the master key")
+	}
+}
+
+func TestWrapWeakSecret(t *testing.T) {
+	k := testKey(t)
+
+	if _, err := k.Wrap(KDFPassphrase, nil); err == nil {
+		t.Fatal("wrapped with an empty passphrase")
+	}
+	if _, err := k.Wrap(KDFKeyFile, make([]byte, minKeyFileSize-1)); err == nil {
+		t.Fatal("wrapped with a short key file")
+	}
+	if _, err := k.Wrap("unknown", []byte("secret")); err == nil {
+		t.Fatal("wrapped with an unknown key derivation")
+	}
+}
+
+func TestCreateKeyFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "zet.key")
+
+	created, err := CreateKeyFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) < minKeyFileSize {
+		t.Fatalf("created a key file of %d bytes", len(created))
+	}
+	if fi, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm()&0077 != 0 {
+		t.Errorf("key file is readable by others: %s", fi.Mode())
+	}
+
+	// an existing key file is kept
+	read, err := CreateKeyFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, created) {
+		t.Fatal("existing key file was replaced")
+	}
+}
+
+func TestUnwrapModifiedParameters(t *testing.T) {
+	w, err := testKey(t).Wrap(KDFPassphrase, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.Threads = 0
+	if _, err := w.Unwrap([]byte("passphrase")); err == nil {
+		t.Fatal("unwrapped with invalid argon2id parameters")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/state"
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 )
 
@@ -18,6 +19,18 @@ func GetMatcher(p project.Project) gitignore.Matcher {
 		patterns = append(patterns, gitignore.ParsePattern(ignoreLine, nil))
 	}
 	patterns = append(patterns, gitignore.ParsePattern(project.ProjectFileName, nil))
-	patterns = append(patterns, gitignore.ParsePattern(".zet", nil))
+	patterns = append(patterns, gitignore.ParsePattern(state.Dir, nil))
+	return gitignore.NewMatcher(patterns)
+}
+
+func GetLockableMatcher(p project.Project) gitignore.Matcher {
+	patterns := make([]gitignore.Pattern, 0, len(p.Lockable))
+	for _, lockable := range p.Lockable {
+		lockable := strings.TrimSpace(lockable)
+		if len(lockable) == 0 {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(lockable, nil))
+	}
 	return gitignore.NewMatcher(patterns)
 }
@@ -1,7 +1,31 @@
 package options
 
+import (
+	"runtime"
+	"time"
+)
+
 var (
-	FlagForce           = false
-	FlagOut     *string = nil
-	FlagVerbose         = false
+	FlagForce                    = false
+	FlagOut              *string = nil
+	FlagVerbose                  = false
+	FlagPorcelain                = false
+	FlagJson                     = false
+	FlagVersion                  = 0
+	FlagMessage                  = ""
+	FlagAuth                     = "password"
+	FlagKey                      = ""
+	FlagAcceptNewHostKey         = false
+	FlagJobs                     = runtime.NumCPU()
+	FlagRepair                   = false
+	FlagBreakStale               = false
+	FlagWait                     = time.Duration(0)
+	FlagAll                      = false
+	FlagYes                      = false
+	FlagOnlyAdded                = false
+	FlagNoDeletes                = false
+	FlagKeyFile                  = ""
+	FlagEndpoint                 = ""
+	FlagRegion                   = ""
+	FlagAccessKey                = ""
 )
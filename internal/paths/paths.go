@@ -87,6 +87,11 @@ func (p Unix) Rel(parent string) (Unix, error) {
 	return Unix(rel), nil
 }
 
+// IsIn reports if p is dir itself or inside of it.
+func (p Unix) IsIn(dir Unix) bool {
+	return dir == "." || p == dir || strings.HasPrefix(string(p), string(dir)+"/")
+}
+
 func (p System) ToString() string {
 	return string(p)
 }
@@ -0,0 +1,88 @@
+package paths
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUnixToGit(t *testing.T) {
+	tests := []struct {
+		unix Unix
+		git  Git
+	}{
+		{"a.txt", Git{"a.txt"}},
+		{"dir/sub/a.txt", Git{"dir", "sub", "a.txt"}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.unix.ToGit(); !slices.Equal(got, tt.git) {
+			t.Errorf("Unix(%q).ToGit() = %q, want %q", tt.unix, got, tt.git)
+		}
+		if got := tt.git.ToUnix(); got != tt.unix {
+			t.Errorf("Git(%q).ToUnix() = %q, want %q", tt.git, got, tt.unix)
+		}
+	}
+}
+
+func TestSystemToGit(t *testing.T) {
+	sys := System(filepath.Join("dir", "sub", "a.txt"))
+	if got, want := sys.ToGit(), (Git{"dir", "sub", "a.txt"}); !slices.Equal(got, want) {
+		t.Errorf("System(%q).ToGit() = %q, want %q", sys, got, want)
+	}
+}
+
+func TestSystemRoundTrip(t *testing.T) {
+	for _, unix := range []Unix{"a.txt", "dir/a.txt", "dir/sub/a b.txt"} {
+		sys := unix.ToSystem()
+		if got, want := sys, System(filepath.FromSlash(string(unix))); got != want {
+			t.Errorf("Unix(%q).ToSystem() = %q, want %q", unix, got, want)
+		}
+		if got := sys.ToUnix(); got != unix {
+			t.Errorf("System(%q).ToUnix() = %q, want %q", sys, got, unix)
+		}
+	}
+}
+
+func TestUnixRel(t *testing.T) {
+	tests := []struct {
+		p, parent Unix
+		want      Unix
+		err       bool
+	}{
+		{"dir/a.txt", "dir", "a.txt", false},
+		{"/remote/meta/dir/a.txt", "/remote/meta", "dir/a.txt", false},
+		{"dir/a.txt", "other", "dir/a.txt", true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.p.Rel(string(tt.parent))
+		if (err != nil) != tt.err {
+			t.Errorf("Unix(%q).Rel(%q) error = %v, want error %t", tt.p, tt.parent, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unix(%q).Rel(%q) = %q, want %q", tt.p, tt.parent, got, tt.want)
+		}
+	}
+}
+
+func TestUnixIsIn(t *testing.T) {
+	tests := []struct {
+		p, dir Unix
+		want   bool
+	}{
+		{"dir/a.txt", ".", true},
+		{"dir", "dir", true},
+		{"dir/a.txt", "dir", true},
+		{"dir/sub/a.txt", "dir", true},
+		{"dirt/a.txt", "dir", false},
+		{"a.txt", "dir", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.IsIn(tt.dir); got != tt.want {
+			t.Errorf("Unix(%q).IsIn(%q) = %t, want %t", tt.p, tt.dir, got, tt.want)
+		}
+	}
+}
@@ -5,3 +5,7 @@ package paths
 func (p System) ToUnix() Unix {
 	return Unix(p)
 }
+
+func (p Unix) ToSystem() System {
+	return System(p)
+}
@@ -18,3 +18,17 @@ func (p System) ToUnix() Unix {
 		return Unix(strings.ReplaceAll(pStr, "\\", "/"))
 	}
 }
+
+func (p Unix) ToSystem() System {
+	pStr := string(p)
+	if len(pStr) >= 2 && pStr[0] == '/' && (len(pStr) == 2 || pStr[2] == '/') {
+		drive := strings.ToUpper(string(pStr[1]))
+		pathWithoutDrive := strings.ReplaceAll(pStr[2:], "/", "\\")
+		if pathWithoutDrive == "" {
+			pathWithoutDrive = "\\"
+		}
+		return System(drive + ":" + pathWithoutDrive)
+	} else {
+		return System(strings.ReplaceAll(pStr, "/", "\\"))
+	}
+}
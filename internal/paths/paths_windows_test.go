@@ -0,0 +1,43 @@
+//go:build windows
+
+package paths
+
+import "testing"
+
+func TestWindowsSystemToUnix(t *testing.T) {
+	tests := []struct {
+		sys  System
+		unix Unix
+	}{
+		{`C:\Users\alice\project`, "/c/Users/alice/project"},
+		{`d:\a.txt`, "/d/a.txt"},
+		{`C:\`, "/c/"},
+		{`dir\sub\a.txt`, "dir/sub/a.txt"},
+		{`a.txt`, "a.txt"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.sys.ToUnix(); got != tt.unix {
+			t.Errorf("System(%q).ToUnix() = %q, want %q", tt.sys, got, tt.unix)
+		}
+	}
+}
+
+func TestWindowsUnixToSystem(t *testing.T) {
+	tests := []struct {
+		unix Unix
+		sys  System
+	}{
+		{"/c/Users/alice/project", `C:\Users\alice\project`},
+		{"/d/a.txt", `D:\a.txt`},
+		{"/c", `C:\`},
+		{"dir/sub/a.txt", `dir\sub\a.txt`},
+		{"a.txt", `a.txt`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.unix.ToSystem(); got != tt.sys {
+			t.Errorf("Unix(%q).ToSystem() = %q, want %q", tt.unix, got, tt.sys)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/charmbracelet/huh"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	// EnvPassword overrides all other sources of the password
+	EnvPassword = "ZET_PASSWORD"
+	// EnvSshKey is the path to a private key or the private key itself, it enables key auth
+	EnvSshKey = "ZET_SSH_KEY"
+	// EnvPassphrase unlocks an encrypted remote
+	EnvPassphrase = "ZET_PASSPHRASE"
+)
+
+// ResolveCredentials fills in the credentials that are not stored in the project file.
+// Passwords are taken from ZET_PASSWORD, the credential helper, the keyring and finally a prompt, in that order.
+func (p *Project) ResolveCredentials() error {
+	if key := os.Getenv(EnvSshKey); key != "" && p.Remote.Scheme() == SchemeSftp {
+		if strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+			p.Remote.KeyData = key
+		} else {
+			p.Remote.Key = key
+		}
+		p.Remote.Auth = AuthKey
+	}
+
+	if !p.Remote.UsesPassword() {
+		return nil
+	}
+
+	if password := os.Getenv(EnvPassword); password != "" {
+		p.Remote.Password = password
+		return nil
+	}
+
+	if p.Remote.CredentialHelper != "" {
+		// like git, a failing helper only means it has no password
+		password, err := p.runCredentialHelper("get")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if password != "" {
+			p.Remote.Password = password
+			return nil
+		}
+	}
+
+	// a missing or unavailable keyring is common on headless machines, so it is not an error
+	if password, err := keyring.Get(KeyringService, p.UserString()); err == nil {
+		p.Remote.Password = password
+		return nil
+	}
+
+	if !util.IsInteractive() {
+		return fmt.Errorf("no password for %s, set %s, configure a credential helper or use `zet auth login`", p.UserString(), EnvPassword)
+	}
+
+	if err := PasswordInteractive(p); err != nil {
+		return errors.Join(errors.New("failed to get password interactively"), err)
+	}
+
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewConfirm().
+			Title(fmt.Sprintf("Remember the password for %s?", p.UserString())).
+			Description(fmt.Sprintf("It is stored in the %s once the remote accepts it", p.credentialStoreName())).
+			Value(&p.Remote.storePassword),
+	)).Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApproveCredentials stores a password that was entered interactively, once the remote accepted it.
+func (p Project) ApproveCredentials() {
+	if !p.Remote.storePassword {
+		return
+	}
+	if err := p.StorePassword(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to remember password, set %s or configure a credential helper instead: %s\n", EnvPassword, err)
+	}
+}
+
+// StorePassword stores the password in the credential helper or the keyring, it does nothing for other auth methods.
+func (p Project) StorePassword() error {
+	if !p.Remote.UsesPassword() {
+		return nil
+	}
+
+	if p.Remote.CredentialHelper != "" {
+		if _, err := p.runCredentialHelper("store"); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if err := keyring.Set(
+		KeyringService,
+		p.UserString(),
+		p.Remote.Password,
+	); err != nil {
+		return errors.Join(errors.New("failed to set keyring credentials"), err)
+	}
+	return nil
+}
+
+// DeletePassword removes the password from the credential helper and the keyring.
+func (p Project) DeletePassword() error {
+	if p.Remote.CredentialHelper != "" {
+		if _, err := p.runCredentialHelper("erase"); err != nil {
+			return err
+		}
+		// the keyring may hold a password from before the helper was configured
+		_ = keyring.Delete(KeyringService, p.UserString())
+		return nil
+	}
+
+	if err := keyring.Delete(KeyringService, p.UserString()); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return errors.Join(errors.New("failed to delete keyring credentials"), err)
+	}
+	return nil
+}
+
+// StoredPassphrase returns the passphrase of an encrypted remote from ZET_PASSPHRASE or the keyring.
+// The source is empty if there is no stored passphrase.
+func (p Project) StoredPassphrase() (passphrase string, source string) {
+	if passphrase := os.Getenv(EnvPassphrase); passphrase != "" {
+		return passphrase, EnvPassphrase
+	}
+	if passphrase, err := keyring.Get(KeyringService, p.passphraseUser()); err == nil {
+		return passphrase, "keyring"
+	}
+	return "", ""
+}
+
+func (p Project) StorePassphrase(passphrase string) error {
+	if err := keyring.Set(KeyringService, p.passphraseUser(), passphrase); err != nil {
+		return errors.Join(errors.New("failed to set keyring passphrase"), err)
+	}
+	return nil
+}
+
+func (p Project) DeletePassphrase() error {
+	if err := keyring.Delete(KeyringService, p.passphraseUser()); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return errors.Join(errors.New("failed to delete keyring passphrase"), err)
+	}
+	return nil
+}
+
+// passphraseUser identifies the passphrase in the keyring, every remote directory has its own.
+func (p Project) passphraseUser() string {
+	return fmt.Sprintf("passphrase %s%s", p.UserString(), p.Remote.Path)
+}
+
+func (p Project) credentialStoreName() string {
+	if p.Remote.CredentialHelper != "" {
+		return fmt.Sprintf("credential helper %s", p.Remote.CredentialHelper)
+	}
+	return "keyring"
+}
+
+// runCredentialHelper calls the credential helper with the action get, store or erase.
+// Like git credential helpers, it reads key=value lines from stdin and get answers with a password=... line.
+func (p Project) runCredentialHelper(action string) (string, error) {
+	var input bytes.Buffer
+	if u, err := url.Parse(p.Remote.URL); err == nil && p.Remote.Scheme() != SchemeSftp {
+		fmt.Fprintf(&input, "protocol=%s\nhost=%s\npath=%s\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	} else {
+		fmt.Fprintf(&input, "protocol=ssh\nhost=%s\nport=%d\n", p.Remote.Hostname, p.Remote.Port)
+	}
+	if p.Remote.Username != "" {
+		fmt.Fprintf(&input, "username=%s\n", p.Remote.Username)
+	}
+	if action == "store" {
+		fmt.Fprintf(&input, "password=%s\n", p.Remote.Password)
+	}
+	input.WriteString("\n")
+
+	cmd := credentialHelperCommand(p.Remote.CredentialHelper, action)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("credential helper %s failed to %s the password", strconv.Quote(p.Remote.CredentialHelper), action), err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if password, ok := strings.CutPrefix(scanner.Text(), "password="); ok {
+			return password, nil
+		}
+	}
+
+	return "", nil
+}
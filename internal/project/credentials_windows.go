@@ -0,0 +1,9 @@
+//go:build windows
+
+package project
+
+import "os/exec"
+
+func credentialHelperCommand(helper string, action string) *exec.Cmd {
+	return exec.Command("cmd", "/C", helper+" "+action)
+}
@@ -3,35 +3,94 @@ package project
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/bloodmagesoftware/zet/internal/compression"
 	ignore_templates "github.com/bloodmagesoftware/zet/internal/ignore/templates"
 	"github.com/charmbracelet/huh"
-	"github.com/zalando/go-keyring"
 	"gopkg.in/yaml.v3"
 )
 
 type (
 	Project struct {
-		Version int    `json:"version"`
-		Remote  Remote `json:"remote"`
-		Ignore  string `json:"ignore"`
+		Version  int      `json:"version"`
+		Remote   Remote   `json:"remote"`
+		Ignore   string   `json:"ignore"`
+		Lockable []string `json:"lockable"`
+		// Compression maps patterns to compression policies, files without a matching pattern use auto
+		Compression compression.Rules `json:"compression,omitempty" yaml:"compression,omitempty"`
+		// EncryptionKeyFile unlocks a remote that is encrypted with a key file instead of a passphrase
+		EncryptionKeyFile string `json:"encryption_key_file,omitempty" yaml:"encryption_key_file,omitempty"`
 	}
 
 	Remote struct {
-		Hostname string `json:"hostname"`
-		Port     int    `json:"port"`
-		Username string `json:"username"`
-		Password string `json:"-"`
-		Path     string `json:"path"`
+		// URL selects the backend of remotes that are not reached over SFTP, like file:///mnt/nas/project, s3://bucket/prefix or a WebDAV https URL
+		URL string `json:"url,omitempty" yaml:"url,omitempty"`
+		// Endpoint is the S3 compatible server of s3 remotes, like https://minio.example.com:9000, empty for AWS
+		Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+		Region   string `json:"region,omitempty" yaml:"region,omitempty"`
+		Hostname string `json:"hostname" yaml:"hostname,omitempty"`
+		Port     int    `json:"port" yaml:"port,omitempty"`
+		// Username is the access key of s3 remotes, the password is the secret key
+		Username string     `json:"username" yaml:"username,omitempty"`
+		Password string     `json:"-" yaml:"-"`
+		Path     string     `json:"path" yaml:"path,omitempty"`
+		Auth     AuthMethod `json:"auth" yaml:"auth,omitempty"`
+		// Key is the private key file used by the key auth method, empty for the default keys in ~/.ssh
+		Key string `json:"key,omitempty" yaml:",omitempty"`
+		// KeyData is a private key that is not stored in a file, it takes precedence over Key
+		KeyData string `json:"-" yaml:"-"`
+		// CredentialHelper is a command that gets, stores and erases the password, like a git credential helper
+		CredentialHelper string `json:"credential_helper,omitempty" yaml:"credential_helper,omitempty"`
+
+		storePassword bool
 	}
+
+	AuthMethod string
+)
+
+const (
+	AuthPassword AuthMethod = "password"
+	AuthKey      AuthMethod = "key"
+	AuthAgent    AuthMethod = "agent"
+)
+
+// ParseAuthMethod parses an auth method, an empty string means password for compatibility with older project files.
+func ParseAuthMethod(s string) (AuthMethod, error) {
+	switch AuthMethod(s) {
+	case "", AuthPassword:
+		return AuthPassword, nil
+	case AuthKey:
+		return AuthKey, nil
+	case AuthAgent:
+		return AuthAgent, nil
+	default:
+		return "", fmt.Errorf("unknown auth method %s, expected %s, %s or %s", s, AuthPassword, AuthKey, AuthAgent)
+	}
+}
+
+const (
+	// SchemeSftp is used by remotes without a URL
+	SchemeSftp = "sftp"
+	// SchemeFile is a remote in a local directory, like a mounted network drive
+	SchemeFile = "file"
+	// SchemeS3 is a remote in a bucket of an S3 compatible object storage
+	SchemeS3 = "s3"
+	// SchemeHttps is a remote on a WebDAV server, like https://cloud.example.com/remote.php/dav/files/alice/project on Nextcloud
+	SchemeHttps = "https"
+	// SchemeHttp is a WebDAV remote without TLS, only use it in trusted networks
+	SchemeHttp = "http"
 )
 
 const (
 	KeyringService  = "de.bloodmagesoftware.zet"
 	ProjectFileName = ".zet.yaml"
-	Version         = 1
+	Version         = 6
 )
 
 func Exists() (bool, error) {
@@ -48,7 +107,22 @@ func Exists() (bool, error) {
 	return true, nil
 }
 
+// Load reads the project file and resolves the credentials of the remote.
 func Load() (Project, error) {
+	p, err := LoadConfig()
+	if err != nil {
+		return p, err
+	}
+
+	if err := p.ResolveCredentials(); err != nil {
+		return p, errors.Join(fmt.Errorf("failed to get credentials for %s", p.UserString()), err)
+	}
+
+	return p, nil
+}
+
+// LoadConfig reads the project file without resolving any credentials.
+func LoadConfig() (Project, error) {
 	p := Project{Remote: Remote{}}
 
 	f, err := os.Open(ProjectFileName)
@@ -62,24 +136,119 @@ func Load() (Project, error) {
 		return p, errors.Join(errors.New("failed to decode project file"), err)
 	}
 
-	if p.Remote.Hostname == "" {
+	if p.Remote.URL != "" {
+		if p.Remote, err = p.Remote.withURL(); err != nil {
+			return p, errors.Join(fmt.Errorf("invalid remote url %s", p.Remote.URL), err)
+		}
+	}
+
+	if p.Remote.Scheme() == SchemeSftp && p.Remote.Hostname == "" {
 		return Project{}, errors.Join(errors.New("unexpected error during project file decoding"), err)
 	}
 
-	{
-		var err error
-		if p.Remote.Password, err = keyring.Get(KeyringService, p.UserString()); err != nil {
-			return p, errors.Join(fmt.Errorf("failed to get keyring credentials for user %s", p.UserString()), err)
-		}
+	if p.Version > Version {
+		return p, fmt.Errorf("project file version %d is newer than the supported version %d, please update", p.Version, Version)
+	}
+
+	if p.Remote.Auth, err = ParseAuthMethod(string(p.Remote.Auth)); err != nil {
+		return p, err
 	}
 
 	return p, nil
 }
 
 func NewInteractive() (Project, error) {
-	p := Project{Version: Version, Remote: Remote{}}
+	p := Project{Version: Version, Remote: Remote{Auth: defaultAuthMethod()}}
 	port := "22"
+	scheme := SchemeSftp
+	var dir, bucket, prefix, davURL string
 	if err := huh.NewForm(huh.NewGroup(
+		huh.NewSelect[string]().
+			Title("Remote").
+			Value(&scheme).
+			Options(
+				huh.Option[string]{Key: "SFTP server", Value: SchemeSftp},
+				huh.Option[string]{Key: "Directory", Value: SchemeFile},
+				huh.Option[string]{Key: "S3 bucket", Value: SchemeS3},
+				huh.Option[string]{Key: "WebDAV server", Value: SchemeHttps},
+			),
+		huh.NewSelect[string]().
+			Title("Ignore template").
+			Value(&p.Ignore).
+			Options(
+				huh.Option[string]{Key: "Default", Value: ignore_templates.Default},
+				huh.Option[string]{Key: "Unreal", Value: ignore_templates.Unreal},
+				huh.Option[string]{Key: "Godot", Value: ignore_templates.Godot},
+				huh.Option[string]{Key: "Bevy", Value: ignore_templates.Bevy},
+			),
+	), huh.NewGroup(
+		huh.NewInput().
+			Title("Directory").
+			Description("Like a mounted network drive, it is created if it does not exist").
+			Value(&dir),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeFile
+	}), huh.NewGroup(
+		huh.NewInput().
+			Title("Endpoint").
+			Description("Like https://minio.example.com:9000, leave empty for AWS").
+			Value(&p.Remote.Endpoint),
+		huh.NewInput().
+			Title("Region").
+			Description("Leave empty to detect it").
+			Value(&p.Remote.Region),
+		huh.NewInput().
+			Title("Bucket").
+			Validate(func(s string) error {
+				if s == "" {
+					return errors.New("must not be empty")
+				}
+				return nil
+			}).
+			Value(&bucket),
+		huh.NewInput().
+			Title("Prefix").
+			Description("Keys of the project start with it, leave empty to use the whole bucket").
+			Value(&prefix),
+		huh.NewInput().
+			Title("Access key").
+			Description("Leave empty to use the AWS environment variables or config files").
+			Value(&p.Remote.Username),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeS3
+	}), huh.NewGroup(
+		huh.NewInput().
+			Title("Secret key").
+			EchoMode(huh.EchoModePassword).
+			Value(&p.Remote.Password),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeS3 || p.Remote.Username == ""
+	}), huh.NewGroup(
+		huh.NewInput().
+			Title("URL").
+			Description("Like https://cloud.example.com/remote.php/dav/files/alice/project for Nextcloud").
+			Validate(func(s string) error {
+				if !strings.HasPrefix(s, SchemeHttps+"://") && !strings.HasPrefix(s, SchemeHttp+"://") {
+					return errors.New("must start with https://")
+				}
+				return nil
+			}).
+			Value(&davURL),
+		huh.NewInput().
+			Title("Username").
+			Description("Leave empty if the server needs no login").
+			Value(&p.Remote.Username),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeHttps
+	}), huh.NewGroup(
+		huh.NewInput().
+			Title("Password").
+			Description("Nextcloud needs an app password if two-factor authentication is enabled").
+			EchoMode(huh.EchoModePassword).
+			Value(&p.Remote.Password),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeHttps || p.Remote.Username == ""
+	}), huh.NewGroup(
 		huh.NewInput().
 			Title("Host").
 			Value(&p.Remote.Hostname),
@@ -98,49 +267,260 @@ func NewInteractive() (Project, error) {
 			Value(&port),
 		huh.NewInput().
 			Title("Username").
+			Description("Leave empty to use the user of your SSH config").
 			Value(&p.Remote.Username),
+		huh.NewSelect[AuthMethod]().
+			Title("Authentication").
+			Value(&p.Remote.Auth).
+			Options(
+				huh.Option[AuthMethod]{Key: "Password", Value: AuthPassword},
+				huh.Option[AuthMethod]{Key: "Private key", Value: AuthKey},
+				huh.Option[AuthMethod]{Key: "SSH agent", Value: AuthAgent},
+			),
+		huh.NewInput().
+			Title("Path").
+			Value(&p.Remote.Path),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeSftp
+	}), huh.NewGroup(
 		huh.NewInput().
 			Title("Password").
 			EchoMode(huh.EchoModePassword).
 			Value(&p.Remote.Password),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeSftp || p.Remote.Auth != AuthPassword
+	}), huh.NewGroup(
 		huh.NewInput().
-			Title("Path").
-			Value(&p.Remote.Path),
-		huh.NewSelect[string]().
-			Title("Ignore template").
-			Value(&p.Ignore).
-			Options(
-				huh.Option[string]{Key: "Default", Value: ignore_templates.Default},
-				huh.Option[string]{Key: "Unreal", Value: ignore_templates.Unreal},
-				huh.Option[string]{Key: "Godot", Value: ignore_templates.Godot},
-				huh.Option[string]{Key: "Bevy", Value: ignore_templates.Bevy},
-			),
-	)).Run(); err != nil {
+			Title("Private key").
+			Description("Leave empty to use the default keys in ~/.ssh").
+			Value(&p.Remote.Key),
+	).WithHideFunc(func() bool {
+		return scheme != SchemeSftp || p.Remote.Auth != AuthKey
+	})).Run(); err != nil {
 		return p, err
 	}
 
 	var err error
+	switch scheme {
+	case SchemeFile:
+		if p.Remote.URL, err = FileURL(dir); err != nil {
+			return p, errors.Join(fmt.Errorf("failed to get absolute path of %s", dir), err)
+		}
+		p.Remote, err = p.Remote.withURL()
+		return p, err
+	case SchemeS3:
+		p.Remote.URL = (&url.URL{Scheme: SchemeS3, Host: bucket, Path: path.Join("/", prefix)}).String()
+		// stored once the remote accepted it
+		p.Remote.storePassword = p.Remote.UsesPassword()
+		p.Remote, err = p.Remote.withURL()
+		return p, err
+	case SchemeHttps:
+		p.Remote.URL = davURL
+		p.Remote, err = p.Remote.withURL()
+		// stored once the remote accepted it
+		p.Remote.storePassword = p.Remote.UsesPassword()
+		return p, err
+	}
+
 	p.Remote.Port, err = strconv.Atoi(port)
 	if err != nil {
 		return p, errors.Join(fmt.Errorf("failed to parse port string %s to int", port), err)
 	}
 
-	if err := keyring.Set(
-		KeyringService,
-		p.UserString(),
-		p.Remote.Password,
-	); err != nil {
-		return p, errors.Join(errors.New("failed to set keyring credentials"), err)
-	}
+	// stored once the remote accepted it
+	p.Remote.storePassword = p.Remote.Auth == AuthPassword
 
 	return p, nil
 }
 
+// defaultAuthMethod prefers a running SSH agent, since it needs no further input.
+func defaultAuthMethod() AuthMethod {
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		return AuthAgent
+	}
+	return AuthPassword
+}
+
+func PasswordInteractive(p *Project) error {
+	return huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title(fmt.Sprintf("%s for %s", p.Remote.passwordName(), p.UserString())).
+			EchoMode(huh.EchoModePassword).
+			Value(&p.Remote.Password),
+	)).Run()
+}
+
+// ParseRemote parses a remote in the form [user@]host[:port]/path or a URL like file:///path.
+func ParseRemote(s string) (Remote, error) {
+	if scheme, _, ok := strings.Cut(s, "://"); ok && scheme != "ssh" && scheme != SchemeSftp {
+		return Remote{URL: s}.withURL()
+	}
+
+	rem := Remote{Port: 22}
+
+	s = strings.TrimPrefix(s, "ssh://")
+	s = strings.TrimPrefix(s, "sftp://")
+
+	// without a user, the one of the SSH config is used
+	if username, rest, ok := strings.Cut(s, "@"); ok {
+		rem.Username = username
+		s = rest
+	}
+
+	slash := strings.Index(s, "/")
+	if slash == -1 {
+		return rem, fmt.Errorf("remote %s has no path", s)
+	}
+	host, remotePath := s[:slash], s[slash:]
+	rem.Path = remotePath
+
+	if hostname, port, ok := strings.Cut(host, ":"); ok {
+		rem.Hostname = hostname
+		var err error
+		rem.Port, err = strconv.Atoi(port)
+		if err != nil {
+			return rem, errors.Join(fmt.Errorf("failed to parse port string %s to int", port), err)
+		}
+		if rem.Port < 0 || rem.Port > 65535 {
+			return rem, fmt.Errorf("port %d out of range 0-65535", rem.Port)
+		}
+	} else {
+		rem.Hostname = host
+	}
+
+	if rem.Hostname == "" {
+		return rem, errors.New("remote has no hostname")
+	}
+
+	return rem, nil
+}
+
+// Scheme returns the scheme of the remote URL, which selects the backend.
+func (r Remote) Scheme() string {
+	scheme, _, ok := strings.Cut(r.URL, "://")
+	if !ok || scheme == "ssh" {
+		return SchemeSftp
+	}
+	return scheme
+}
+
+// withURL fills in the fields that are derived from the URL.
+func (r Remote) withURL() (Remote, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return r, err
+	}
+
+	switch r.Scheme() {
+	case SchemeSftp:
+		rem, err := ParseRemote(strings.TrimPrefix(r.URL, u.Scheme+"://"))
+		if err != nil {
+			return r, err
+		}
+		rem.URL = r.URL
+		rem.Auth = r.Auth
+		rem.Key = r.Key
+		rem.CredentialHelper = r.CredentialHelper
+		return rem, nil
+	case SchemeFile:
+		if u.Host != "" && u.Host != "localhost" {
+			return r, fmt.Errorf("file remotes can't be on host %s, mount it instead", u.Host)
+		}
+		if u.Path == "" {
+			return r, errors.New("file remote has no path")
+		}
+		r.Path = u.Path
+		// file:///C:/dir on Windows
+		if len(r.Path) >= 3 && r.Path[0] == '/' && r.Path[2] == ':' {
+			r.Path = r.Path[1:]
+		}
+		return r, nil
+	case SchemeS3:
+		if u.Host == "" {
+			return r, errors.New("s3 remote has no bucket")
+		}
+		// the prefix of all keys, as an absolute path like the paths of other remotes
+		r.Path = path.Join("/", u.Path)
+		return r, nil
+	case SchemeHttps, SchemeHttp:
+		if u.Host == "" {
+			return r, errors.New("webdav remote has no host")
+		}
+		// https://alice@cloud.example.com/... sets the username, the password is never stored in the project file
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return r, fmt.Errorf("don't put the password into the remote url, set %s or use `zet auth login` instead", EnvPassword)
+			}
+			if r.Username == "" {
+				r.Username = u.User.Username()
+			}
+			u.User = nil
+			r.URL = u.String()
+		}
+		r.Path = path.Join("/", u.Path)
+		return r, nil
+	default:
+		return r, fmt.Errorf("unsupported remote scheme %s", u.Scheme)
+	}
+}
+
+// FileURL returns the URL of a remote in the local directory dir.
+func FileURL(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: SchemeFile, Path: filepath.ToSlash(abs)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path
+	}
+	return u.String(), nil
+}
+
+// UsesPassword reports if the remote needs a password, which is the secret key for s3 remotes with an access key.
+func (r Remote) UsesPassword() bool {
+	switch r.Scheme() {
+	case SchemeSftp:
+		return r.Auth == AuthPassword
+	case SchemeS3:
+		// without an access key, the credentials of the AWS environment and config files are used
+		return r.Username != ""
+	case SchemeHttps, SchemeHttp:
+		return r.Username != ""
+	default:
+		return false
+	}
+}
+
+func (r Remote) passwordName() string {
+	if r.Scheme() == SchemeS3 {
+		return "Secret key"
+	}
+	return "Password"
+}
+
 func (p Project) UserString() string {
+	if p.Remote.URL != "" && p.Remote.Scheme() != SchemeSftp {
+		if p.Remote.Username != "" {
+			return fmt.Sprintf("%s@%s", p.Remote.Username, p.Remote.URL)
+		}
+		return p.Remote.URL
+	}
 	return fmt.Sprintf("%s@%s:%d", p.Remote.Username, p.Remote.Hostname, p.Remote.Port)
 }
 
 func Save(p Project) error {
+	if p.Remote.URL != "" {
+		// derived from the URL when loading
+		p.Remote.Path = ""
+		if p.Remote.Scheme() == SchemeSftp {
+			p.Remote.Hostname, p.Remote.Port, p.Remote.Username = "", 0, ""
+		}
+	}
+	if p.Remote.Scheme() != SchemeSftp {
+		p.Remote.Auth = ""
+	}
+
 	f, err := os.Create(ProjectFileName)
 	if err != nil {
 		return errors.Join(errors.New("failed to open project file"), err)
@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// Backend stores the files of a remote.
+// Names are slash separated and include the path of the remote.
+type Backend interface {
+	Stat(name string) (fs.FileInfo, error)
+	// Open opens a file for reading.
+	Open(name string) (File, error)
+	// Create opens a file for writing and creates it if it does not exist.
+	// The content of an existing file is kept, so interrupted uploads to backends that write in place can be continued.
+	// With exclusive, it fails with fs.ErrExist instead of opening an existing file.
+	Create(name string, exclusive bool) (File, error)
+	// Rename moves a file and replaces the target if it exists.
+	Rename(oldname, newname string) error
+	// Link creates newname with the content of oldname and fails if newname exists, so only one client can create it.
+	Link(oldname, newname string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	ReadDir(name string) ([]fs.FileInfo, error)
+	// Walk walks the file tree below root, directories come before their content.
+	Walk(root string) Walker
+	MkdirAll(name string) error
+	Close() error
+}
+
+// inPlaceWriter is implemented by backends whose files are written in place, so the bytes written before an
+// interruption stay on the remote. Other backends upload a file only once it is closed, so uploads to them can't be resumed.
+type inPlaceWriter interface {
+	writesInPlace()
+}
+
+// File is an open file of a backend.
+type File interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Stat() (fs.FileInfo, error)
+	Truncate(size int64) error
+}
+
+// Walker steps through a file tree, like github.com/kr/fs.Walker.
+type Walker interface {
+	Step() bool
+	Err() error
+	Path() string
+	Stat() fs.FileInfo
+}
+
+// connectBackend connects to the backend selected by the scheme of the remote URL.
+func connectBackend(p project.Project) (Backend, error) {
+	switch p.Remote.Scheme() {
+	case project.SchemeSftp:
+		return connectSftp(p)
+	case project.SchemeFile:
+		return newFileBackend(), nil
+	case project.SchemeS3:
+		return connectS3(p)
+	case project.SchemeHttps, project.SchemeHttp:
+		return connectWebdav(p)
+	default:
+		return nil, fmt.Errorf("unsupported remote scheme %s", p.Remote.Scheme())
+	}
+}
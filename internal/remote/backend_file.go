@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	krfs "github.com/kr/fs"
+)
+
+// fileBackend stores the remote in a local directory, like a mounted network drive.
+type fileBackend struct{}
+
+func newFileBackend() *fileBackend {
+	return &fileBackend{}
+}
+
+func (fileBackend) writesInPlace() {}
+
+func (fileBackend) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(name))
+}
+
+func (fileBackend) Open(name string) (File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+func (fileBackend) Create(name string, exclusive bool) (File, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if exclusive {
+		flags |= os.O_EXCL
+	}
+	return os.OpenFile(filepath.FromSlash(name), flags, 0644)
+}
+
+func (fileBackend) Rename(oldname, newname string) error {
+	return os.Rename(filepath.FromSlash(oldname), filepath.FromSlash(newname))
+}
+
+func (fileBackend) Link(oldname, newname string) error {
+	err := os.Link(filepath.FromSlash(oldname), filepath.FromSlash(newname))
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		return err
+	}
+
+	// network drives often have no hard links, an exclusive create still lets only one client win
+	src, openErr := os.Open(filepath.FromSlash(oldname))
+	if openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	defer src.Close()
+
+	dst, createErr := os.OpenFile(filepath.FromSlash(newname), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if createErr != nil {
+		return createErr
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(filepath.FromSlash(newname))
+		return err
+	}
+	return dst.Close()
+}
+
+func (fileBackend) Remove(name string) error {
+	return os.Remove(filepath.FromSlash(name))
+}
+
+func (fileBackend) RemoveAll(name string) error {
+	return os.RemoveAll(filepath.FromSlash(name))
+}
+
+func (fileBackend) ReadDir(name string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(filepath.FromSlash(name))
+	if err != nil {
+		return nil, err
+	}
+
+	fis := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// removed in the meantime
+				continue
+			}
+			return nil, err
+		}
+		fis = append(fis, fi)
+	}
+	return fis, nil
+}
+
+func (b fileBackend) Walk(root string) Walker {
+	return krfs.WalkFS(root, b)
+}
+
+func (fileBackend) MkdirAll(name string) error {
+	return os.MkdirAll(filepath.FromSlash(name), 0755)
+}
+
+func (fileBackend) Close() error {
+	return nil
+}
+
+// Lstat and Join let the backend be walked with krfs.WalkFS.
+
+func (fileBackend) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(filepath.FromSlash(name))
+}
+
+func (fileBackend) Join(elem ...string) string {
+	return path.Join(elem...)
+}
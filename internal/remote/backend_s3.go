@@ -0,0 +1,486 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the part size of multipart uploads, larger blobs are uploaded in parallel parts.
+const s3PartSize = 64 << 20
+
+// s3MaxCopySize is the largest object that can be copied in a single request.
+const s3MaxCopySize = 5 << 30
+
+// s3Backend stores the remote in a bucket of an S3 compatible object storage.
+// Directories don't exist on their own, they only show up through the keys below them.
+type s3Backend struct {
+	client *minio.Client
+	bucket string
+	// root is the path of the remote, where the check of conditional writes writes to
+	root string
+
+	conditionalOnce sync.Once
+	conditionalErr  error
+}
+
+func connectS3(p project.Project) (*s3Backend, error) {
+	u, err := url.Parse(p.Remote.URL)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid remote url %s", p.Remote.URL), err)
+	}
+
+	endpoint, secure := "s3.amazonaws.com", true
+	if p.Remote.Endpoint != "" {
+		eu, err := url.Parse(p.Remote.Endpoint)
+		if err != nil || eu.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint %s, expected a url like https://minio.example.com:9000", p.Remote.Endpoint)
+		}
+		endpoint, secure = eu.Host, eu.Scheme != "http"
+	}
+
+	var creds *credentials.Credentials
+	if p.Remote.Username != "" {
+		creds = credentials.NewStaticV4(p.Remote.Username, p.Remote.Password, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: p.Remote.Region,
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to create s3 client for %s", endpoint), err)
+	}
+
+	// fails early on wrong credentials
+	if exists, err := client.BucketExists(context.Background(), u.Host); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to access bucket %s on %s", u.Host, endpoint), err)
+	} else if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist on %s", u.Host, endpoint)
+	}
+	p.ApproveCredentials()
+
+	return &s3Backend{client: client, bucket: u.Host, root: p.Remote.Path}, nil
+}
+
+// checkConditionalWrites makes sure the endpoint refuses to overwrite an object when asked with If-None-Match.
+// Locks rely on it, an endpoint that ignores it would let two clients take the same lock.
+// It is checked before the first exclusive write, so read-only commands never write.
+func (b *s3Backend) checkConditionalWrites() error {
+	b.conditionalOnce.Do(func() {
+		b.conditionalErr = b.probeConditionalWrites()
+	})
+	return b.conditionalErr
+}
+
+func (b *s3Backend) probeConditionalWrites() error {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	key := s3Key(path.Join(b.root, DirTemp, "conditional-write-check."+hex.EncodeToString(suffix)))
+
+	opts := minio.PutObjectOptions{}
+	opts.SetMatchETagExcept("*")
+
+	if _, err := b.client.PutObject(context.Background(), b.bucket, key, bytes.NewReader(nil), 0, opts); err != nil {
+		return errors.Join(fmt.Errorf("failed to write to bucket %s", b.bucket), err)
+	}
+	defer b.client.RemoveObject(context.Background(), b.bucket, key, minio.RemoveObjectOptions{})
+
+	_, err := b.client.PutObject(context.Background(), b.bucket, key, bytes.NewReader(nil), 0, opts)
+	if isS3PreconditionFailed(err) {
+		return nil
+	} else if err != nil {
+		return errors.Join(fmt.Errorf("failed to write to bucket %s", b.bucket), err)
+	}
+	return fmt.Errorf("the s3 endpoint of bucket %s ignores If-None-Match, it can't be used as a remote because locks would not be exclusive", b.bucket)
+}
+
+func (b *s3Backend) Stat(name string) (fs.FileInfo, error) {
+	key := s3Key(name)
+	if key == "" {
+		return s3FileInfo{name: "/", dir: true}, nil
+	}
+
+	info, err := b.client.StatObject(context.Background(), b.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return newS3FileInfo(info), nil
+	}
+	if !isS3NotFound(err) {
+		return nil, err
+	}
+
+	if found, err := b.hasKeysBelow(name); err != nil {
+		return nil, err
+	} else if found {
+		return s3FileInfo{name: path.Base(name), dir: true}, nil
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (b *s3Backend) Open(name string) (File, error) {
+	obj, err := b.client.GetObject(context.Background(), b.bucket, s3Key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// the request is only sent on first use
+	info, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		if isS3NotFound(err) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+
+	return &s3ReadFile{Object: obj, info: newS3FileInfo(info)}, nil
+}
+
+// Create writes into a local temporary file, which is uploaded when the file is closed, so uploads are never resumed.
+// An exclusive file is uploaded with If-None-Match, so it fails on close if the file exists by then.
+func (b *s3Backend) Create(name string, exclusive bool) (File, error) {
+	if exclusive {
+		if err := b.checkConditionalWrites(); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "zet-s3-*")
+	if err != nil {
+		return nil, err
+	}
+	f := &s3WriteFile{File: tmp, backend: b, name: name, exclusive: exclusive}
+
+	if !exclusive {
+		if err := f.download(); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Rename copies the object and removes the old one, an interruption can leave both behind.
+func (b *s3Backend) Rename(oldname, newname string) error {
+	stat, err := b.Stat(oldname)
+	if err != nil {
+		return err
+	}
+
+	dst := minio.CopyDestOptions{Bucket: b.bucket, Object: s3Key(newname)}
+	src := minio.CopySrcOptions{Bucket: b.bucket, Object: s3Key(oldname)}
+	// a plain copy is limited to 5 GiB, larger objects are copied in parts
+	if stat.Size() <= s3MaxCopySize {
+		_, err = b.client.CopyObject(context.Background(), dst, src)
+	} else {
+		_, err = b.client.ComposeObject(context.Background(), dst, src)
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.Remove(oldname)
+}
+
+// Link uploads newname with the condition that it does not exist yet.
+func (b *s3Backend) Link(oldname, newname string) error {
+	if err := b.checkConditionalWrites(); err != nil {
+		return err
+	}
+
+	src, err := b.Open(oldname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	opts := minio.PutObjectOptions{}
+	opts.SetMatchETagExcept("*")
+	if _, err := b.client.PutObject(context.Background(), b.bucket, s3Key(newname), src, stat.Size(), opts); err != nil {
+		if isS3PreconditionFailed(err) {
+			return &fs.PathError{Op: "link", Path: newname, Err: fs.ErrExist}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (b *s3Backend) Remove(name string) error {
+	return b.client.RemoveObject(context.Background(), b.bucket, s3Key(name), minio.RemoveObjectOptions{})
+}
+
+func (b *s3Backend) RemoveAll(name string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	objects := b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: s3DirPrefix(name), Recursive: true})
+	for err := range b.client.RemoveObjects(ctx, b.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if err.Err != nil {
+			return errors.Join(fmt.Errorf("failed to remove %s", err.ObjectName), err.Err)
+		}
+	}
+
+	return b.Remove(name)
+}
+
+func (b *s3Backend) ReadDir(name string) ([]fs.FileInfo, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var fis []fs.FileInfo
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: s3DirPrefix(name)}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		fis = append(fis, newS3FileInfo(obj))
+	}
+
+	return fis, nil
+}
+
+func (b *s3Backend) Walk(root string) Walker {
+	return &s3Walker{backend: b, root: root}
+}
+
+// MkdirAll does nothing, directories don't exist on their own.
+func (b *s3Backend) MkdirAll(name string) error {
+	return nil
+}
+
+func (b *s3Backend) Close() error {
+	return nil
+}
+
+func (b *s3Backend) hasKeysBelow(name string) (bool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: s3DirPrefix(name), MaxKeys: 1}) {
+		if obj.Err != nil {
+			return false, obj.Err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// s3Key returns the object key of a remote file name.
+func s3Key(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// s3DirPrefix returns the prefix of all keys below the directory name.
+func s3DirPrefix(name string) string {
+	if key := s3Key(name); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+func isS3NotFound(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound
+}
+
+func isS3PreconditionFailed(err error) bool {
+	resp := minio.ToErrorResponse(err)
+	return resp.Code == "PreconditionFailed" || resp.StatusCode == http.StatusPreconditionFailed
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// newS3FileInfo describes an object, or a directory if the key of a listing ends with a slash.
+func newS3FileInfo(info minio.ObjectInfo) s3FileInfo {
+	return s3FileInfo{
+		name:    path.Base(info.Key),
+		size:    info.Size,
+		modTime: info.LastModified,
+		dir:     strings.HasSuffix(info.Key, "/"),
+	}
+}
+
+func (fi s3FileInfo) Name() string       { return fi.name }
+func (fi s3FileInfo) Size() int64        { return fi.size }
+func (fi s3FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi s3FileInfo) IsDir() bool        { return fi.dir }
+func (fi s3FileInfo) Sys() any           { return nil }
+
+func (fi s3FileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+type s3ReadFile struct {
+	*minio.Object
+	info s3FileInfo
+}
+
+func (f *s3ReadFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *s3ReadFile) Write(p []byte) (int, error) {
+	return 0, errors.New("s3 object is opened for reading")
+}
+
+func (f *s3ReadFile) Truncate(size int64) error {
+	return errors.New("s3 object is opened for reading")
+}
+
+type s3WriteFile struct {
+	*os.File
+	backend   *s3Backend
+	name      string
+	exclusive bool
+	closed    bool
+}
+
+// download copies the existing object into the temporary file, like opening an existing file keeps its content.
+func (f *s3WriteFile) download() error {
+	src, err := f.backend.Open(f.name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(f.File, src); err != nil {
+		return err
+	}
+	_, err = f.File.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close uploads the temporary file, large files are uploaded in parts.
+func (f *s3WriteFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer os.Remove(f.File.Name())
+	defer f.File.Close()
+
+	stat, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	opts := minio.PutObjectOptions{PartSize: s3PartSize}
+	if f.exclusive {
+		opts.SetMatchETagExcept("*")
+	}
+	if _, err := f.backend.client.PutObject(context.Background(), f.backend.bucket, s3Key(f.name), f.File, stat.Size(), opts); err != nil {
+		if isS3PreconditionFailed(err) {
+			return &fs.PathError{Op: "create", Path: f.name, Err: fs.ErrExist}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// s3Walker lists all objects below root, the root comes first and directories are not listed.
+type s3Walker struct {
+	backend *s3Backend
+	root    string
+	names   []string
+	infos   []s3FileInfo
+	started bool
+	err     error
+}
+
+func (w *s3Walker) Step() bool {
+	if !w.started {
+		w.started = true
+		w.names, w.infos, w.err = w.backend.list(w.root)
+		if w.err == nil && len(w.names) == 0 {
+			w.err = &fs.PathError{Op: "walk", Path: w.root, Err: fs.ErrNotExist}
+		}
+		// the root itself
+		w.names = append([]string{w.root}, w.names...)
+		w.infos = append([]s3FileInfo{{name: path.Base(w.root), dir: true}}, w.infos...)
+		return true
+	}
+
+	if w.err != nil || len(w.names) <= 1 {
+		return false
+	}
+	w.names, w.infos = w.names[1:], w.infos[1:]
+	return true
+}
+
+func (w *s3Walker) Err() error {
+	return w.err
+}
+
+func (w *s3Walker) Path() string {
+	return w.names[0]
+}
+
+func (w *s3Walker) Stat() fs.FileInfo {
+	return w.infos[0]
+}
+
+// list returns the names and infos of all objects below the directory root.
+func (b *s3Backend) list(root string) ([]string, []s3FileInfo, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var names []string
+	var infos []s3FileInfo
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: s3DirPrefix(root), Recursive: true}) {
+		if obj.Err != nil {
+			return nil, nil, obj.Err
+		}
+		names = append(names, path.Join(root, strings.TrimPrefix(obj.Key, s3DirPrefix(root))))
+		infos = append(infos, newS3FileInfo(obj))
+	}
+
+	return names, infos, nil
+}
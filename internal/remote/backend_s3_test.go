@@ -0,0 +1,244 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+)
+
+func TestS3Backend(t *testing.T) {
+	p := newS3TestProject(t)
+	b, err := connectS3(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := p.Remote.Path
+
+	if _, err := b.Stat(path.Join(root, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("stat of a missing file: %v", err)
+	}
+
+	f, err := b.Create(path.Join(root, "dir/a"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := b.Create(path.Join(root, "dir/a"), true); err == nil {
+		if err := f.Close(); !os.IsExist(err) {
+			t.Fatalf("exclusive create of an existing file: %v", err)
+		}
+	} else if !os.IsExist(err) {
+		t.Fatalf("exclusive create of an existing file: %v", err)
+	}
+	if fi, err := b.Stat(path.Join(root, "dir")); err != nil || !fi.IsDir() {
+		t.Fatalf("stat of a directory: %v", err)
+	}
+
+	if err := b.Link(path.Join(root, "dir/a"), path.Join(root, "dir/b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Link(path.Join(root, "dir/a"), path.Join(root, "dir/b")); !os.IsExist(err) {
+		t.Fatalf("link to an existing file: %v", err)
+	}
+	if err := b.Rename(path.Join(root, "dir/b"), path.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	fis, err := b.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	slices.Sort(names)
+	if want := []string{"c", "dir"}; !slices.Equal(names, want) {
+		t.Fatalf("directory has %v, want %v", names, want)
+	}
+
+	var walked []string
+	w := b.Walk(root)
+	for w.Step() {
+		if w.Err() != nil {
+			t.Fatal(w.Err())
+		}
+		walked = append(walked, strings.TrimPrefix(w.Path(), root))
+	}
+	if want := []string{"", "/c", "/dir/a"}; !slices.Equal(walked, want) {
+		t.Fatalf("walked %v, want %v", walked, want)
+	}
+
+	// a non exclusive create keeps the content, like opening an existing file
+	f, err = b.Create(path.Join(root, "dir/a"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(" world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRemote(t, b, path.Join(root, "dir/a")); string(got) != "hello world" {
+		t.Fatalf("got %q, want %q", got, "hello world")
+	}
+
+	if err := b.RemoveAll(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("stat after removing everything: %v", err)
+	}
+}
+
+func TestS3BackendMultipart(t *testing.T) {
+	p := newS3TestProject(t)
+	b, err := connectS3(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := path.Join(p.Remote.Path, "big")
+
+	big := make([]byte, s3PartSize+1)
+	for i := range big {
+		big[i] = byte(i * 7)
+	}
+	f, err := b.Create(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(big); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := b.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if _, err := rf.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, big[1000:]) {
+		t.Fatal("multipart upload changed the content")
+	}
+}
+
+func TestS3IgnoredConditions(t *testing.T) {
+	p, fake := newS3TestProjectWith(t)
+	fake.ignoreConditions = true
+
+	// read-only commands work and don't write
+	r := connectTest(t, p)
+	if _, err := r.IsEmpty(); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	writes := fake.writes
+	fake.mu.Unlock()
+	if writes != 0 {
+		t.Fatalf("connecting and reading wrote %d times", writes)
+	}
+
+	if unlock, err := r.lockPush(); err == nil {
+		unlock()
+		t.Fatal("took a lock on an endpoint that ignores If-None-Match")
+	} else if !strings.Contains(err.Error(), "ignores If-None-Match") {
+		t.Fatalf("got %v, want the endpoint to be refused", err)
+	}
+}
+
+func TestS3InterruptedRename(t *testing.T) {
+	p, fake := newS3TestProjectWith(t)
+	newWorkTree(t)
+	writeFile(t, "a.txt", "a")
+
+	r := connectTest(t, p)
+	withMessage(t, "")
+	if err := r.InitialCommit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// uploads are copied to their object, but not removed
+	uploadsPrefix := s3DirPrefix(path.Join(p.Remote.Path, DirUploads))
+	fake.mu.Lock()
+	fake.failDeletes = uploadsPrefix
+	fake.mu.Unlock()
+
+	writeFile(t, "b.txt", "b")
+	withMessage(t, "second")
+	if err := r.CommitPaths(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := remoteNames(t, r), []paths.Unix{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("remote has %v, want %v", got, want)
+	}
+	if n := countKeys(fake, uploadsPrefix); n != 1 {
+		t.Fatalf("remote has %d uploads, want the one that was not removed", n)
+	}
+
+	// the next push removes it, since its object exists
+	fake.mu.Lock()
+	fake.failDeletes = ""
+	fake.mu.Unlock()
+
+	writeFile(t, "c.txt", "c")
+	withMessage(t, "third")
+	if err := r.CommitPaths(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := countKeys(fake, uploadsPrefix); n != 0 {
+		t.Fatalf("remote has %d uploads left", n)
+	}
+}
+
+func countKeys(fake *fakeS3, prefix string) int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	n := 0
+	for key := range fake.objects {
+		if strings.HasPrefix(key, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func readRemote(t *testing.T, b Backend, name string) []byte {
+	t.Helper()
+
+	f, err := b.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
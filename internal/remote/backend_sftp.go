@@ -0,0 +1,89 @@
+package remote
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+type sftpBackend struct {
+	sshClient  *ssh.Client
+	sftpClient *sftp.Client
+}
+
+func connectSftp(p project.Project) (*sftpBackend, error) {
+	sshClient, err := connectSsh(p)
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to establish ssh connection"), err)
+	}
+	p.ApproveCredentials()
+
+	sftpClient, err := sftp.NewClient(sshClient, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, errors.Join(errors.New("failed to establish sftp connection"), err)
+	}
+
+	return &sftpBackend{sshClient: sshClient, sftpClient: sftpClient}, nil
+}
+
+func (b *sftpBackend) writesInPlace() {}
+
+func (b *sftpBackend) Stat(name string) (fs.FileInfo, error) {
+	return b.sftpClient.Stat(name)
+}
+
+func (b *sftpBackend) Open(name string) (File, error) {
+	return b.sftpClient.Open(name)
+}
+
+func (b *sftpBackend) Create(name string, exclusive bool) (File, error) {
+	flags := os.O_WRONLY | os.O_CREATE
+	if exclusive {
+		flags |= os.O_EXCL
+	}
+	return b.sftpClient.OpenFile(name, flags)
+}
+
+func (b *sftpBackend) Rename(oldname, newname string) error {
+	return b.sftpClient.PosixRename(oldname, newname)
+}
+
+func (b *sftpBackend) Link(oldname, newname string) error {
+	return b.sftpClient.Link(oldname, newname)
+}
+
+func (b *sftpBackend) Remove(name string) error {
+	return b.sftpClient.Remove(name)
+}
+
+func (b *sftpBackend) RemoveAll(name string) error {
+	return b.sftpClient.RemoveAll(name)
+}
+
+func (b *sftpBackend) ReadDir(name string) ([]fs.FileInfo, error) {
+	return b.sftpClient.ReadDir(name)
+}
+
+func (b *sftpBackend) Walk(root string) Walker {
+	return b.sftpClient.Walk(root)
+}
+
+func (b *sftpBackend) MkdirAll(name string) error {
+	return b.sftpClient.MkdirAll(name)
+}
+
+func (b *sftpBackend) Close() error {
+	if err := b.sftpClient.Close(); err != nil {
+		_ = b.sshClient.Close()
+		return errors.Join(errors.New("failed to close SFTP client"), err)
+	}
+	if err := b.sshClient.Close(); err != nil {
+		return errors.Join(errors.New("failed to close SSH client"), err)
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package remote
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	krfs "github.com/kr/fs"
+)
+
+// webdavPropfind asks for the properties that describe a file.
+const webdavPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// webdavBackend stores the remote on a WebDAV server, like Nextcloud.
+// Names are the paths of the server URL.
+type webdavBackend struct {
+	client   *http.Client
+	base     url.URL
+	username string
+	password string
+}
+
+func connectWebdav(p project.Project) (*webdavBackend, error) {
+	u, err := url.Parse(p.Remote.URL)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("invalid remote url %s", p.Remote.URL), err)
+	}
+
+	b := &webdavBackend{
+		client:   &http.Client{},
+		base:     url.URL{Scheme: u.Scheme, Host: u.Host},
+		username: p.Remote.Username,
+		password: p.Remote.Password,
+	}
+
+	// fails early on wrong credentials, the remote directory itself may not exist yet
+	if _, err := b.Stat(p.Remote.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Join(fmt.Errorf("failed to access %s", p.UserString()), err)
+	}
+	p.ApproveCredentials()
+
+	return b, nil
+}
+
+func (b *webdavBackend) Stat(name string) (fs.FileInfo, error) {
+	fis, err := b.propfind(name, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(fis) == 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fis[0], nil
+}
+
+func (b *webdavBackend) Open(name string) (File, error) {
+	// the size comes from PROPFIND, responses to GET may be chunked and have no length
+	fis, err := b.propfind(name, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(fis) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	f := &webdavReadFile{backend: b, name: name, info: fis[0]}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Create writes into a local temporary file, which is uploaded when the file is closed, so uploads are never resumed.
+func (b *webdavBackend) Create(name string, exclusive bool) (File, error) {
+	if exclusive {
+		if _, err := b.Stat(name); err == nil {
+			return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrExist}
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "zet-webdav-*")
+	if err != nil {
+		return nil, err
+	}
+	f := &webdavWriteFile{File: tmp, backend: b, name: name, exclusive: exclusive}
+
+	if !exclusive {
+		if err := f.download(); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (b *webdavBackend) Rename(oldname, newname string) error {
+	return b.copyMove("MOVE", oldname, newname, true)
+}
+
+// Link copies oldname on the server, which refuses to overwrite newname, so only one client can create it.
+func (b *webdavBackend) Link(oldname, newname string) error {
+	return b.copyMove("COPY", oldname, newname, false)
+}
+
+func (b *webdavBackend) Remove(name string) error {
+	resp, err := b.do(http.MethodDelete, name, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return webdavError("remove", name, resp)
+	}
+	return nil
+}
+
+// RemoveAll removes name and everything below it, which is what DELETE does on a directory.
+func (b *webdavBackend) RemoveAll(name string) error {
+	if err := b.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *webdavBackend) ReadDir(name string) ([]fs.FileInfo, error) {
+	fis, err := b.propfind(name, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	// the directory itself is part of the response
+	entries := make([]fs.FileInfo, 0, len(fis))
+	for _, fi := range fis {
+		if fi.href != path.Clean("/"+name) {
+			entries = append(entries, fi)
+		}
+	}
+	return entries, nil
+}
+
+func (b *webdavBackend) Walk(root string) Walker {
+	return krfs.WalkFS(root, b)
+}
+
+func (b *webdavBackend) MkdirAll(name string) error {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return nil
+	}
+
+	resp, err := b.do("MKCOL", name, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusMethodNotAllowed:
+		// 405 means the directory exists
+		return nil
+	case http.StatusConflict:
+		// the parent is missing
+		if err := b.MkdirAll(path.Dir(name)); err != nil {
+			return err
+		}
+		return b.MkdirAll(name)
+	default:
+		return webdavError("mkdir", name, resp)
+	}
+}
+
+func (b *webdavBackend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// Lstat and Join let the backend be walked with krfs.WalkFS.
+
+func (b *webdavBackend) Lstat(name string) (fs.FileInfo, error) {
+	return b.Stat(name)
+}
+
+func (b *webdavBackend) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (b *webdavBackend) url(name string) string {
+	u := b.base
+	u.Path = path.Clean("/" + name)
+	return u.String()
+}
+
+// do sends a request for the file name, size is the length of body or -1 if there is none.
+func (b *webdavBackend) do(method, name string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		// some servers, like Nextcloud behind php-fpm, don't support chunked uploads
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: wrong username or password", method, name)
+	}
+	return resp, nil
+}
+
+func (b *webdavBackend) copyMove(method, oldname, newname string, overwrite bool) error {
+	header := http.Header{"Destination": {b.url(newname)}, "Overwrite": {"F"}}
+	if overwrite {
+		header.Set("Overwrite", "T")
+	}
+
+	resp, err := b.do(method, oldname, nil, -1, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return &fs.PathError{Op: strings.ToLower(method), Path: newname, Err: fs.ErrExist}
+	default:
+		return webdavError(strings.ToLower(method), oldname, resp)
+	}
+}
+
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind lists name and, with depth 1, the files in it.
+// Depth infinity is not used, since servers like Nextcloud disable it.
+func (b *webdavBackend) propfind(name, depth string) ([]webdavFileInfo, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := b.do("PROPFIND", name, strings.NewReader(webdavPropfind), int64(len(webdavPropfind)), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, webdavError("propfind", name, resp)
+	}
+
+	var ms webdavMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to parse propfind response of %s", name), err)
+	}
+
+	fis := make([]webdavFileInfo, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("invalid href %s in propfind response of %s", r.Href, name), err)
+		}
+
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			fi := webdavFileInfo{
+				href: path.Clean("/" + href.Path),
+				dir:  ps.Prop.ResourceType.Collection != nil,
+			}
+			fi.name = path.Base(fi.href)
+			fi.size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			fi.modTime, _ = http.ParseTime(ps.Prop.LastModified)
+			fis = append(fis, fi)
+			break
+		}
+	}
+
+	return fis, nil
+}
+
+// webdavError turns an unexpected response into an error, with fs.ErrNotExist for missing files.
+func webdavError(op, name string, resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusConflict:
+		// 409 means the parent directory is missing
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case http.StatusPreconditionFailed:
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	default:
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("server responded %s", resp.Status)}
+	}
+}
+
+type webdavFileInfo struct {
+	// href is the path of the file on the server
+	href    string
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi webdavFileInfo) Name() string       { return fi.name }
+func (fi webdavFileInfo) Size() int64        { return fi.size }
+func (fi webdavFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi webdavFileInfo) IsDir() bool        { return fi.dir }
+func (fi webdavFileInfo) Sys() any           { return nil }
+
+func (fi webdavFileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// webdavReadFile streams a file with GET, seeking starts a new ranged request.
+type webdavReadFile struct {
+	backend *webdavBackend
+	name    string
+	info    webdavFileInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (f *webdavReadFile) open() error {
+	var header http.Header
+	if f.offset > 0 {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%d-", f.offset)}}
+	}
+
+	resp, err := f.backend.do(http.MethodGet, f.name, nil, -1, header)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if _, err := io.CopyN(io.Discard, resp.Body, f.offset); err != nil {
+			// the server ignored the range
+			resp.Body.Close()
+			return err
+		}
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// at the end of the file
+		resp.Body.Close()
+		f.body = io.NopCloser(strings.NewReader(""))
+		return nil
+	default:
+		resp.Body.Close()
+		return webdavError("open", f.name, resp)
+	}
+
+	f.body = resp.Body
+	return nil
+}
+
+func (f *webdavReadFile) Read(p []byte) (int, error) {
+	if f.body == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *webdavReadFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != f.offset && f.body != nil {
+		_ = f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *webdavReadFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *webdavReadFile) Write(p []byte) (int, error) {
+	return 0, errors.New("webdav file is opened for reading")
+}
+
+func (f *webdavReadFile) Truncate(size int64) error {
+	return errors.New("webdav file is opened for reading")
+}
+
+func (f *webdavReadFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+type webdavWriteFile struct {
+	*os.File
+	backend   *webdavBackend
+	name      string
+	exclusive bool
+	closed    bool
+}
+
+// download copies the existing file into the temporary file, like opening an existing file keeps its content.
+func (f *webdavWriteFile) download() error {
+	src, err := f.backend.Open(f.name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(f.File, src); err != nil {
+		return err
+	}
+	_, err = f.File.Seek(0, io.SeekStart)
+	return err
+}
+
+// Close uploads the temporary file with PUT.
+func (f *webdavWriteFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	defer os.Remove(f.File.Name())
+	defer f.File.Close()
+
+	stat, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var header http.Header
+	if f.exclusive {
+		// servers that ignore the condition are protected by the check in Create, which leaves a short window for races
+		header = http.Header{"If-None-Match": {"*"}}
+	}
+	resp, err := f.backend.do(http.MethodPut, f.name, io.NopCloser(f.File), stat.Size(), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	default:
+		return webdavError("create", f.name, resp)
+	}
+}
@@ -0,0 +1,157 @@
+package remote
+
+import (
+	"io"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestWebdavBackend(t *testing.T) {
+	p := newWebdavTestProject(t)
+	b, err := connectWebdav(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	// names that are percent-encoded in hrefs
+	dir := path.Join(p.Remote.Path, "deep/with space/ünï%20")
+	if err := b.MkdirAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.MkdirAll(dir); err != nil {
+		t.Fatalf("make an existing directory: %v", err)
+	}
+	if fi, err := b.Stat(dir); err != nil {
+		t.Fatal(err)
+	} else if !fi.IsDir() || fi.Name() != "ünï%20" {
+		t.Fatalf("stat of a directory: name %q, dir %t", fi.Name(), fi.IsDir())
+	}
+
+	f, err := b.Create(path.Join(dir, "a b.txt"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.MkdirAll(path.Join(dir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directory itself is in the response, with a trailing slash
+	fis, err := b.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	slices.Sort(names)
+	if want := []string{"a b.txt", "sub"}; !slices.Equal(names, want) {
+		t.Fatalf("directory has %v, want %v", names, want)
+	}
+
+	if got := readRemote(t, b, path.Join(dir, "a b.txt")); string(got) != "content" {
+		t.Fatalf("got %q, want %q", got, "content")
+	}
+	if _, err := b.Open(path.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("open of a missing file: %v", err)
+	}
+}
+
+func TestWebdavExclusiveCreate(t *testing.T) {
+	p := newWebdavTestProject(t)
+	b, err := connectWebdav(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	if err := b.MkdirAll(p.Remote.Path); err != nil {
+		t.Fatal(err)
+	}
+	name := path.Join(p.Remote.Path, "lock")
+
+	// both pass the check in Create, only the condition of the upload decides
+	first, err := b.Create(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.Create(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Close(); !os.IsExist(err) {
+		t.Fatalf("second exclusive create: %v", err)
+	}
+
+	if err := b.Link(name, name+".copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Link(name, name+".copy"); !os.IsExist(err) {
+		t.Fatalf("link to an existing file: %v", err)
+	}
+}
+
+func TestWebdavChunkedSize(t *testing.T) {
+	p, fake := newWebdavTestProjectWith(t)
+	fake.chunked = true
+	b, err := connectWebdav(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	if err := b.MkdirAll(p.Remote.Path); err != nil {
+		t.Fatal(err)
+	}
+	name := path.Join(p.Remote.Path, "file")
+
+	f, err := b.Create(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := b.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if fi, err := rf.Stat(); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() != 10 {
+		t.Fatalf("size is %d, want 10", fi.Size())
+	}
+	if _, err := rf.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rf); err != nil {
+		t.Fatal(err)
+	} else if string(got) != "6789" {
+		t.Fatalf("got %q after seeking from the end, want %q", got, "6789")
+	}
+}
+
+func TestWebdavWrongPassword(t *testing.T) {
+	p := newWebdavTestProject(t)
+	p.Remote.Password = "wrong"
+
+	if r, err := Connect(p); err == nil {
+		_ = r.Close()
+		t.Fatal("connected with a wrong password")
+	}
+}
@@ -0,0 +1,382 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+const testBucket = "zet"
+
+// fakeS3 is an in-memory S3 server that implements just enough of the API for the s3 backend.
+// It answers in path style, which the client uses for endpoints without a domain.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]map[int][]byte
+	nextID  int
+
+	// ignoreConditions makes it behave like stores that don't support If-None-Match
+	ignoreConditions bool
+	// failDeletes makes deletes of keys with this prefix fail without retries, to interrupt renames after the copy
+	failDeletes string
+	// writes counts the requests that change the bucket
+	writes int
+}
+
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func (o fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// newS3TestProject starts a fake S3 server and returns a project whose remote is an empty prefix in a bucket on it.
+func newS3TestProject(t *testing.T) project.Project {
+	t.Helper()
+
+	p, _ := newS3TestProjectWith(t)
+	return p
+}
+
+// newS3TestProjectWith is newS3TestProject that also returns the fake server, so tests can change its behavior.
+func newS3TestProjectWith(t *testing.T) (project.Project, *fakeS3) {
+	t.Helper()
+
+	isolateTestEnv(t)
+
+	fake := &fakeS3{objects: make(map[string]fakeObject), uploads: make(map[string]map[int][]byte)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	rem, err := project.ParseRemote("s3://" + testBucket + "/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rem.Endpoint = srv.URL
+	rem.Region = "us-east-1"
+	rem.Username = testUsername
+	rem.Password = testPassword
+
+	return project.Project{Version: project.Version, Remote: rem}, fake
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// read before locking, a request may stream from another request to the same server
+	body, err := readS3Body(r)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		f.writes++
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testBucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+		case r.Method == http.MethodGet && q.Get("list-type") == "2":
+			f.list(w, q)
+		case r.Method == http.MethodPost && q.Has("delete"):
+			f.deleteMany(w, body)
+		default:
+			writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		o, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", o.etag())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", o.modTime, bytes.NewReader(o.data))
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		parts, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set("ETag", fakeObject{data: body}.etag())
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		o, ok := f.objects[srcKey]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		o = fakeObject{data: bytes.Clone(o.data), modTime: time.Now()}
+		f.objects[key] = o
+		writeS3Xml(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: o.etag(), LastModified: o.modTime.UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodPut:
+		if !f.checkConditions(w, r, key) {
+			return
+		}
+		o := fakeObject{data: body, modTime: time.Now()}
+		f.objects[key] = o
+		w.Header().Set("ETag", o.etag())
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		if f.failDeletes != "" && strings.HasPrefix(key, f.failDeletes) {
+			writeS3Error(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		writeS3Xml(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		parts, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if !f.checkConditions(w, r, key) {
+			return
+		}
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		slices.Sort(numbers)
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		o := fakeObject{data: data, modTime: time.Now()}
+		f.objects[key] = o
+		writeS3Xml(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: o.etag()})
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// checkConditions answers with 412 if the request must not overwrite the existing object key.
+func (f *fakeS3) checkConditions(w http.ResponseWriter, r *http.Request, key string) bool {
+	if f.ignoreConditions || r.Header.Get("If-None-Match") != "*" {
+		return true
+	}
+	if _, ok := f.objects[key]; ok {
+		writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return false
+	}
+	return true
+}
+
+// list answers ListObjectsV2, the continuation token is the last key or common prefix of the previous page.
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("continuation-token")
+	if after == "" {
+		after = q.Get("start-after")
+	}
+	maxKeys := 1000
+	if m, err := strconv.Atoi(q.Get("max-keys")); err == nil {
+		maxKeys = m
+	}
+	encode := func(s string) string {
+		if q.Get("encoding-type") == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+		StorageClass string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Delimiter             string
+		EncodingType          string `xml:",omitempty"`
+		MaxKeys               int
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string         `xml:",omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}{Name: testBucket, Prefix: encode(prefix), Delimiter: delimiter, EncodingType: q.Get("encoding-type"), MaxKeys: maxKeys}
+
+	for _, key := range keys {
+		// keys below a delimiter after the prefix are listed once as their common prefix
+		entry := key
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			entry = key[:len(prefix)+i+len(delimiter)]
+		}
+		if entry <= after || entry == result.NextContinuationToken {
+			continue
+		}
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		result.NextContinuationToken = entry
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(entry)})
+			continue
+		}
+		o := f.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          encode(key),
+			LastModified: o.modTime.UTC().Format(time.RFC3339),
+			ETag:         o.etag(),
+			Size:         len(o.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	writeS3Xml(w, result)
+}
+
+// deleteMany answers DeleteObjects.
+func (f *fakeS3) deleteMany(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	type deleted struct {
+		Key string
+	}
+	result := struct {
+		XMLName xml.Name  `xml:"DeleteResult"`
+		Deleted []deleted `xml:"Deleted"`
+	}{}
+	for _, o := range req.Objects {
+		delete(f.objects, o.Key)
+		result.Deleted = append(result.Deleted, deleted{Key: o.Key})
+	}
+
+	writeS3Xml(w, result)
+}
+
+// readS3Body reads the body of the request and removes the aws-chunked framing of streaming signatures.
+func readS3Body(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return b, nil
+	}
+
+	// every chunk is "<hex size>;chunk-signature=<signature>\r\n<data>\r\n", the last one is empty
+	br := bufio.NewReader(bytes.NewReader(b))
+	var data []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeStr, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeStr, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+		if _, err := br.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeS3Xml(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, code)
+}
@@ -0,0 +1,289 @@
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	testUsername = "zet"
+	testPassword = "secret"
+)
+
+// testBackends create a project with an empty remote on every backend the end-to-end tests run against.
+var testBackends = []struct {
+	name       string
+	newProject func(t *testing.T) project.Project
+}{
+	{"sftp", newSftpTestProject},
+	{"s3", newS3TestProject},
+	{"webdav", newWebdavTestProject},
+}
+
+// forEachBackend runs test as a subtest for every test backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, p project.Project)) {
+	for _, b := range testBackends {
+		t.Run(b.name, func(t *testing.T) {
+			test(t, b.newProject(t))
+		})
+	}
+}
+
+// newSftpTestProject starts an in-process SSH server with an SFTP subsystem on 127.0.0.1
+// and returns a project whose remote is an empty directory on it.
+// The server serves the local file system, so tests can look at the remote directory directly.
+func newSftpTestProject(t *testing.T) project.Project {
+	t.Helper()
+
+	isolateTestEnv(t)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() != testUsername || string(password) != testPassword {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+
+	// created before the server, so it is removed after the server closed all files in it
+	remoteDir := filepath.Join(t.TempDir(), "remote")
+	if err := os.Mkdir(remoteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return project.Project{
+		Version: project.Version,
+		Remote: project.Remote{
+			Hostname: "127.0.0.1",
+			Port:     startTestServer(t, config),
+			Username: testUsername,
+			Password: testPassword,
+			Path:     filepath.ToSlash(remoteDir),
+			Auth:     project.AuthPassword,
+		},
+	}
+}
+
+// isolateTestEnv keeps the known hosts, SSH config and agent of the developer out of the test.
+func isolateTestEnv(t *testing.T) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv(project.EnvSshKey, "")
+	t.Setenv(project.EnvPassword, testPassword)
+
+	acceptNewHostKey := options.FlagAcceptNewHostKey
+	options.FlagAcceptNewHostKey = true
+	t.Cleanup(func() { options.FlagAcceptNewHostKey = acceptNewHostKey })
+}
+
+// startTestServer starts an SSH server with an SFTP subsystem on 127.0.0.1 and returns its port.
+func startTestServer(t *testing.T, config *ssh.ServerConfig) int {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.AddHostKey(signer)
+
+	return serveTestServer(t, config)
+}
+
+// serveTestServer is startTestServer for configs that already have their host keys.
+func serveTestServer(t *testing.T, config *ssh.ServerConfig) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		_ = l.Close()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go serveTestConn(conn, config, &wg)
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// serveTestConn answers the sftp subsystem requests of one SSH connection.
+// It calls wg.Done once the connection and all of its sftp servers are closed.
+func serveTestConn(conn net.Conn, config *ssh.ServerConfig, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			wg.Add(1)
+			go forwardTestChannel(newChannel, wg)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				isSftp := req.Type == "subsystem" && len(req.Payload) >= 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(isSftp, nil)
+				if !isSftp {
+					continue
+				}
+
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					_ = channel.Close()
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = server.Serve()
+					_ = server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// forwardTestChannel connects a direct-tcpip channel to its destination, so the server can be used as a jump host.
+func forwardTestChannel(newChannel ssh.NewChannel, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	var dest struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &dest); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port))))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		done <- struct{}{}
+	}()
+	<-done
+	_ = conn.Close()
+	_ = channel.Close()
+	<-done
+}
+
+// connectTest connects to the remote of p and closes the connection when the test ends.
+func connectTest(t *testing.T, p project.Project) *Remote {
+	t.Helper()
+
+	r, err := Connect(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	return r
+}
+
+// newWorkTree changes into a new empty working tree, which is removed when the test ends.
+func newWorkTree(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	return dir
+}
+
+// writeFile writes a file of the working tree and creates its parent directories.
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	name = filepath.FromSlash(name)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile reads a file of the working tree.
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.FromSlash(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// withMessage sets the commit message until the test ends.
+func withMessage(t *testing.T, message string) {
+	t.Helper()
+
+	old := options.FlagMessage
+	options.FlagMessage = message
+	t.Cleanup(func() { options.FlagMessage = old })
+}
@@ -2,17 +2,32 @@ package remote
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 
+	"github.com/bloodmagesoftware/zet/internal/crypt"
 	"github.com/bloodmagesoftware/zet/internal/project"
-	"github.com/pkg/sftp"
-	"golang.org/x/crypto/ssh"
+	"github.com/bloodmagesoftware/zet/internal/state"
 )
 
+// transferBufferSize is the size of reads and writes on remote files.
+const transferBufferSize = 1 << 20
+
 type Remote struct {
-	SshClient  *ssh.Client
-	SftpClient *sftp.Client
-	Config     project.Project
+	Backend Backend
+	Config  project.Project
+	Layout  int
+	base    state.Base
+	// diffHead is the remote head the last diff was based on
+	diffHead string
+	// pushLock is set while this client holds the push lock
+	pushLock *heldPushLock
+	// key encrypts everything on the remote, it is nil for unencrypted remotes
+	key *crypt.Key
+
+	objectLocksMu sync.Mutex
+	objectLocks   map[string]*sync.Mutex
 }
 
 func (r *Remote) Close() error {
@@ -20,40 +35,58 @@ func (r *Remote) Close() error {
 		return nil
 	}
 
-	if r.SftpClient != nil {
-		if err := r.SftpClient.Close(); err != nil {
-			_ = r.SshClient.Close()
-			return errors.Join(errors.New("failed to close SFTP client"), err)
-		}
-		r.SftpClient = nil
+	if r.Backend == nil {
+		return nil
 	}
 
-	if r.SshClient != nil {
-		if err := r.SshClient.Close(); err != nil {
-			return errors.Join(errors.New("failed to close SSH client"), err)
-		}
-		r.SshClient = nil
+	err := r.Backend.Close()
+	r.Backend = nil
+	return err
+}
+
+// lockObject serializes uploads of the same content, call the returned function to unlock.
+func (r *Remote) lockObject(hash []byte) func() {
+	key := string(hash)
+
+	r.objectLocksMu.Lock()
+	if r.objectLocks == nil {
+		r.objectLocks = make(map[string]*sync.Mutex)
 	}
+	mu, ok := r.objectLocks[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		r.objectLocks[key] = mu
+	}
+	r.objectLocksMu.Unlock()
 
-	return nil
+	mu.Lock()
+	return mu.Unlock
 }
 
 func Connect(p project.Project) (*Remote, error) {
 	r := &Remote{Config: p}
 	var err error
 
-	r.SshClient, err = connectSsh(p)
-	if err != nil {
-		return nil, errors.Join(errors.New("failed to establish ssh connection"), err)
+	if r.Backend, err = connectBackend(p); err != nil {
+		return nil, err
 	}
 
-	r.SftpClient, err = sftp.NewClient(r.SshClient)
-	if err != nil {
-		return nil, errors.Join(errors.New("failed to establish sftp connection"), err)
+	if err := r.Backend.MkdirAll(p.Remote.Path); err != nil && !os.IsExist(err) {
+		_ = r.Backend.Close()
+		return nil, errors.Join(errors.New("failed to make remote directory"), err)
 	}
 
-	if err := r.SftpClient.MkdirAll(p.Remote.Path); err != nil && !os.IsExist(err) {
-		return nil, errors.Join(errors.New("failed to make remote directory"), err)
+	if r.Layout, err = r.LayoutVersion(); err != nil {
+		_ = r.Backend.Close()
+		return nil, errors.Join(errors.New("failed to get remote layout version"), err)
+	} else if r.Layout > project.Version {
+		_ = r.Backend.Close()
+		return nil, fmt.Errorf("remote uses layout version %d but this client only supports up to version %d, please update", r.Layout, project.Version)
+	}
+
+	if err := r.loadKey(); err != nil {
+		_ = r.Backend.Close()
+		return nil, errors.Join(errors.New("failed to unlock encrypted remote"), err)
 	}
 
 	return r, nil
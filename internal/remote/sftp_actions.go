@@ -1,9 +1,7 @@
 package remote
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,26 +10,36 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"slices"
+	"strconv"
 	"time"
 
 	"github.com/bloodmagesoftware/zet/internal/ignore"
 	"github.com/bloodmagesoftware/zet/internal/options"
 	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
 	"github.com/bloodmagesoftware/zet/internal/user"
 	"github.com/charmbracelet/huh"
 )
 
 const (
-	DirContent = "content"
-	DirMeta    = "meta"
-	FileIgnore = "ignore"
+	DirContent  = "content"
+	DirObjects  = "objects"
+	DirMeta     = "meta"
+	DirHistory  = "history"
+	DirCommits  = "commits"
+	DirStaging  = "staging"
+	FileIgnore  = "ignore"
+	FileVersion = "version"
+	FileHead    = "HEAD"
 )
 
 type Meta struct {
 	Hash       []byte    `json:"hash"`
 	LastEditor string    `json:"last_editor"`
 	LastEdit   time.Time `json:"last_edit"`
+	Version    int       `json:"version,omitempty"`
+	Deleted    bool      `json:"deleted,omitempty"`
+	Commit     string    `json:"commit,omitempty"`
 }
 
 type (
@@ -48,28 +56,69 @@ const (
 	commitFileStatusCreate commitFileStatus = iota
 	commitFileStatusDelete
 	commitFileStatusChange
+	// commitFileStatusConflict marks files changed locally and on the remote since the last sync
+	commitFileStatusConflict
 )
 
 func (cfs commitFileStatus) ToString() string {
 	switch cfs {
 	case commitFileStatusCreate:
-		return "ADD   "
+		return "ADD     "
 	case commitFileStatusDelete:
-		return "DELETE"
+		return "DELETE  "
 	case commitFileStatusChange:
-		return "CHANGE"
+		return "CHANGE  "
+	case commitFileStatusConflict:
+		return "CONFLICT"
 	default:
 		return "?"
 	}
 }
 
+func (cfs commitFileStatus) ToPorcelain() byte {
+	switch cfs {
+	case commitFileStatusCreate:
+		return 'A'
+	case commitFileStatusDelete:
+		return 'D'
+	case commitFileStatusChange:
+		return 'M'
+	case commitFileStatusConflict:
+		return 'C'
+	default:
+		return '?'
+	}
+}
+
+func (cfs commitFileStatus) MarshalText() ([]byte, error) {
+	switch cfs {
+	case commitFileStatusCreate:
+		return []byte("add"), nil
+	case commitFileStatusDelete:
+		return []byte("delete"), nil
+	case commitFileStatusChange:
+		return []byte("change"), nil
+	case commitFileStatusConflict:
+		return []byte("conflict"), nil
+	default:
+		return nil, fmt.Errorf("unknown commit file status %d", cfs)
+	}
+}
+
 func (r *Remote) IsEmpty() (bool, error) {
-	fis, err := r.SftpClient.ReadDir(r.Config.Remote.Path)
+	fis, err := r.Backend.ReadDir(r.Config.Remote.Path)
 	if err != nil {
 		return false, errors.Join(fmt.Errorf("failed to read directory %s", r.Config.Remote.Path), err)
 	}
 
-	return len(fis) == 0, nil
+	// the key of an encrypted remote, the push lock and the temp dir they were written to exist before the initial commit
+	for _, fi := range fis {
+		if fi.Name() != FileKey && fi.Name() != FilePushLock && fi.Name() != DirTemp {
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
 
 func (r *Remote) InitialCommit() error {
@@ -77,12 +126,40 @@ func (r *Remote) InitialCommit() error {
 		fmt.Println("initial commit")
 	}
 
+	unlock, err := r.lockPush()
+	if err != nil {
+		return err
+	}
+
+	// someone else may have pushed the initial commit while this push waited for the lock
+	if empty, err := r.IsEmpty(); err != nil {
+		unlock()
+		return errors.Join(errors.New("failed to check if remote directory is empty"), err)
+	} else if !empty {
+		unlock()
+		if options.FlagVerbose {
+			fmt.Println("remote is no longer empty, pushing local changes instead")
+		}
+		if r.Layout, err = r.LayoutVersion(); err != nil {
+			return errors.Join(errors.New("failed to get remote layout version"), err)
+		}
+		return r.CommitPaths(nil)
+	}
+	defer unlock()
+
+	if err := r.pushVersion(); err != nil {
+		return errors.Join(errors.New("failed to push version"), err)
+	}
+	r.Layout = project.Version
+
 	if err := r.pushIgnore(); err != nil {
 		return errors.Join(errors.New("failed to push ignore"), err)
 	}
 
 	ignoreMatcher := ignore.GetMatcher(r.Config)
 
+	var files []*commitFile
+
 	if err := paths.WalkDir(".", func(sysPath paths.System, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -103,21 +180,31 @@ func (r *Remote) InitialCommit() error {
 			return nil
 		}
 
-		if err := r.pushFile(sysPath); err != nil {
-			return errors.Join(fmt.Errorf("failed to push file %s to remote", sysPath), err)
-		}
+		files = append(files, &commitFile{
+			Path:     sysPath,
+			Status:   commitFileStatusCreate,
+			LastEdit: time.Now(),
+		})
 
 		return nil
 	}); err != nil {
 		return errors.Join(errors.New("failed to walk repo dir"), err)
 	}
 
+	if options.FlagMessage == "" {
+		options.FlagMessage = "initial commit"
+	}
+
+	if err := r.commit(files); err != nil {
+		return errors.Join(errors.New("failed to commit"), err)
+	}
+
 	return nil
 }
 
 func (r *Remote) CommitInteractive() error {
-	if err := r.pushIgnore(); err != nil {
-		return errors.Join(errors.New("failed to push ignore"), err)
+	if r.Layout < project.Version {
+		return fmt.Errorf("remote uses the outdated layout version %d, use `%s migrate` to upgrade it", r.Layout, filepath.Base(os.Args[0]))
 	}
 
 	commitables, err := r.getCommitable()
@@ -125,6 +212,11 @@ func (r *Remote) CommitInteractive() error {
 		return errors.Join(errors.New("failed to get local changes"), err)
 	}
 
+	locks, err := r.getLocks()
+	if err != nil {
+		return errors.Join(errors.New("failed to get locks"), err)
+	}
+
 	opts := make([]huh.Option[*commitFile], len(commitables))
 
 	for i, cf := range commitables {
@@ -133,159 +225,199 @@ func (r *Remote) CommitInteractive() error {
 				Key:   fmt.Sprintf("%s %s", cf.Status.ToString(), cf.Path.ToString()),
 				Value: &cf,
 			}
+		} else if cf.Status == commitFileStatusConflict {
+			opts[i] = huh.Option[*commitFile]{
+				Key:   fmt.Sprintf("%s %s also changed at %s by %s", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor),
+				Value: &cf,
+			}
 		} else {
 			opts[i] = huh.Option[*commitFile]{
 				Key:   fmt.Sprintf("%s %s previously changed at %s by %s", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor),
 				Value: &cf,
 			}
 		}
+		if l, ok := locks[cf.Path.ToUnix()]; ok {
+			opts[i].Key += fmt.Sprintf(" (%s)", l.ToString())
+		}
 	}
 
 	var selectedCommitables []*commitFile
 
-	if err := huh.NewForm(huh.NewGroup(
+	fields := []huh.Field{
 		huh.NewMultiSelect[*commitFile]().
 			Title("Diff from current remote").
 			Options(opts...).
 			Value(&selectedCommitables),
-	)).Run(); err != nil {
+	}
+	if options.FlagMessage == "" {
+		fields = append(fields, huh.NewInput().
+			Title("Message").
+			Value(&options.FlagMessage))
+	}
+
+	if err := huh.NewForm(huh.NewGroup(fields...)).Run(); err != nil {
 		return err
 	}
 
-	for _, cf := range selectedCommitables {
-		switch cf.Status {
-		case commitFileStatusCreate:
-			if err := r.pushFile(cf.Path.(paths.System)); err != nil {
-				return errors.Join(fmt.Errorf("failed to create %s", cf.Path.ToString()), err)
-			}
-		case commitFileStatusDelete:
-			if err := r.removeFile(cf.Path); err != nil {
-				return errors.Join(fmt.Errorf("failed to delete %s", cf.Path.ToString()), err)
-			}
-		case commitFileStatusChange:
-			if err := r.pushFile(cf.Path.(paths.System)); err != nil {
-				return errors.Join(fmt.Errorf("failed to change %s", cf.Path.ToString()), err)
-			}
-		}
+	if len(selectedCommitables) == 0 {
+		fmt.Println("nothing selected")
+		return nil
 	}
 
-	return nil
+	// the selection may take a while, so others can push until it is done
+	return r.pushSelected(selectedCommitables)
 }
 
-func (r *Remote) getCommitable() ([]commitFile, error) {
-	ignoreMatcher := ignore.GetMatcher(r.Config)
-	now := time.Now()
-
-	var (
-		commitables   []commitFile
-		existingFiles []paths.Unix
-	)
-
-	if options.FlagVerbose {
-		fmt.Println("checking local files for changes")
+// CommitPaths pushes all changes in the given files and directories without asking, or all changes if none are given.
+func (r *Remote) CommitPaths(names []paths.System) error {
+	if r.Layout < project.Version {
+		return fmt.Errorf("remote uses the outdated layout version %d, use `%s migrate` to upgrade it", r.Layout, filepath.Base(os.Args[0]))
 	}
 
-	if err := paths.WalkDir(".", func(sysPath paths.System, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		gitPath := sysPath.ToGit()
+	commitables, err := r.getCommitable()
+	if err != nil {
+		return errors.Join(errors.New("failed to get local changes"), err)
+	}
 
-		isDir := d.IsDir()
-		if ignoreMatcher.Match(gitPath, isDir) {
-			// excluded from ignore
-			if isDir {
-				return filepath.SkipDir
-			} else {
-				return nil
+	var selectedCommitables []*commitFile
+	matched := make([]bool, len(names))
+	for i := range commitables {
+		cf := &commitables[i]
+		selected := len(names) == 0
+		for j, name := range names {
+			if cf.Path.ToUnix().IsIn(name.ToUnix()) {
+				matched[j] = true
+				selected = true
 			}
 		}
-		if isDir {
-			return nil
+		if selected {
+			selectedCommitables = append(selectedCommitables, cf)
 		}
+	}
 
-		unixPath := sysPath.ToUnix()
-		existingFiles = append(existingFiles, unixPath)
-
-		if exists, err := r.existsOnRemote(unixPath); err != nil {
-			return errors.Join(fmt.Errorf("failed to check if file %s exists on remote", sysPath), err)
-		} else if !exists {
-			commitables = append(commitables, commitFile{
-				sysPath,
-				commitFileStatusCreate,
-				"",
-				now,
-			})
-			return nil
+	// a typo in a path must not look like a successful push of nothing
+	var unmatched []error
+	for j, name := range names {
+		if !matched[j] {
+			unmatched = append(unmatched, fmt.Errorf("path %s matches no changes", name.ToString()))
 		}
+	}
+	if len(unmatched) != 0 {
+		return errors.Join(unmatched...)
+	}
 
-		rm, err := r.getRemoteMeta(unixPath)
-		if err != nil {
-			return errors.Join(fmt.Errorf("failed to get remote meta from %s", unixPath), err)
+	for _, cf := range selectedCommitables {
+		fmt.Printf("%s %s\n", cf.Status.ToString(), cf.Path.ToString())
+	}
+
+	if len(selectedCommitables) == 0 {
+		fmt.Println("nothing to push")
+		return nil
+	}
+
+	if options.FlagMessage == "" {
+		options.FlagMessage = fmt.Sprintf("push from %s", user.Host())
+	}
+
+	return r.pushSelected(selectedCommitables)
+}
+
+func (r *Remote) pushSelected(files []*commitFile) error {
+	unlock, err := r.lockPush()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := r.Recover(); err != nil {
+		return errors.Join(errors.New("failed to recover interrupted commits"), err)
+	}
+
+	// others may have pushed since the changes were checked, check them again now that nobody else can push
+	if head, err := r.Head(); err != nil {
+		return errors.Join(errors.New("failed to get remote head"), err)
+	} else if head != r.diffHead {
+		if options.FlagVerbose {
+			fmt.Println("remote changed, checking local changes again")
 		}
-		lh, err := sysPath.Hash()
-		if err != nil {
-			return errors.Join(fmt.Errorf("failed to get hash from %s", sysPath), err)
+		if files, err = r.refreshSelected(files); err != nil {
+			return errors.Join(errors.New("failed to get local changes"), err)
 		}
-		if bytes.Equal(rm.Hash, lh) {
+		if len(files) == 0 {
+			fmt.Println("nothing to push")
 			return nil
 		}
-		commitables = append(commitables, commitFile{
-			sysPath,
-			commitFileStatusChange,
-			rm.LastEditor,
-			rm.LastEdit,
-		})
+	}
 
-		return nil
-	}); err != nil {
-		return nil, errors.Join(errors.New("failed to walk repo dir"), err)
+	if err := r.pushIgnore(); err != nil {
+		return errors.Join(errors.New("failed to push ignore"), err)
 	}
 
-	if options.FlagVerbose {
-		fmt.Println("checking remote files for deletes")
+	if err := r.commit(files); err != nil {
+		return errors.Join(errors.New("failed to commit"), err)
 	}
 
-	remoteWalkRoot := path.Join(r.Config.Remote.Path, DirMeta)
-	remoteWalker := r.SftpClient.Walk(remoteWalkRoot)
-	for remoteWalker.Step() {
-		unixPath, err := paths.Unix(remoteWalker.Path()).Rel(remoteWalkRoot)
-		if err != nil {
-			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
-		}
-		gitPath := unixPath.ToGit()
+	return nil
+}
 
-		isDir := remoteWalker.Stat().IsDir()
-		if ignoreMatcher.Match(gitPath, isDir) {
-			// excluded from ignore
-			if isDir {
-				remoteWalker.SkipDir()
-			}
-			continue
+// refreshSelected diffs again and returns the current state of the selected files.
+// Files that are no longer changed are dropped.
+func (r *Remote) refreshSelected(files []*commitFile) ([]*commitFile, error) {
+	commitables, err := r.getCommitable()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[paths.Unix]*commitFile, len(commitables))
+	for i := range commitables {
+		current[commitables[i].Path.ToUnix()] = &commitables[i]
+	}
+
+	refreshed := make([]*commitFile, 0, len(files))
+	for _, cf := range files {
+		if c, ok := current[cf.Path.ToUnix()]; ok {
+			refreshed = append(refreshed, c)
 		}
-		if isDir {
+	}
+	return refreshed, nil
+}
+
+func (r *Remote) getCommitable() ([]commitFile, error) {
+	diffs, err := r.diff()
+	if err != nil {
+		return nil, err
+	}
+
+	commitables := make([]commitFile, 0, len(diffs))
+	for _, fd := range diffs {
+		if fd.LocalStatus == nil {
 			continue
 		}
 
-		rf, err := r.SftpClient.Open(remoteWalker.Path())
-		if err != nil {
-			return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteWalker.Path()), err)
+		cf := commitFile{
+			Path:     fd.Path.ToSystem(),
+			Status:   *fd.LocalStatus,
+			LastEdit: time.Now(),
+		}
+		if fd.Local == nil {
+			cf.Path = fd.Path
+		}
+		if fd.Remote != nil {
+			cf.LastEditor = fd.Remote.LastEditor
+			cf.LastEdit = fd.Remote.LastEdit
 		}
-		defer rf.Close()
-		rm := Meta{}
-		if json.NewDecoder(rf).Decode(&rm); err != nil {
-			return nil, errors.Join(fmt.Errorf("failed to get remote meta from %s", unixPath), err)
+		if fd.IsConflict() {
+			cf.Status = commitFileStatusConflict
 		}
 
-		if slices.Index(existingFiles, unixPath) == -1 {
-			commitables = append(commitables, commitFile{
-				unixPath,
-				commitFileStatusDelete,
-				rm.LastEditor,
-				rm.LastEdit,
-			})
+		if options.FlagOnlyAdded && cf.Status != commitFileStatusCreate {
+			continue
+		}
+		if options.FlagNoDeletes && cf.Status == commitFileStatusDelete {
+			continue
 		}
+
+		commitables = append(commitables, cf)
 	}
 
 	return commitables, nil
@@ -299,12 +431,18 @@ func (r *Remote) pushIgnore() error {
 
 	remoteName := path.Join(r.Config.Remote.Path, FileIgnore)
 
-	rf, err := r.SftpClient.Create(remoteName)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open file %s on remote", remoteName))
+	// a missing ignore file is read as empty, which is the same as no ignore rules
+	if remoteIgnore, err := r.PullIgnore(); err == nil && remoteIgnore == r.Config.Ignore {
+		if options.FlagVerbose {
+			fmt.Print("unchanged")
+		}
+		return nil
 	}
-	defer rf.Close()
-	if _, err := rf.Write([]byte(r.Config.Ignore)); err != nil {
+
+	if err := r.writeRemoteFile(remoteName, func(w io.Writer) error {
+		_, err := io.WriteString(w, r.Config.Ignore)
+		return err
+	}); err != nil {
 		return errors.Join(errors.New("failed to write ignore to remote"), err)
 	}
 
@@ -316,20 +454,12 @@ func (r *Remote) pushIgnore() error {
 }
 
 func (r *Remote) existsOnRemote(name paths.Path) (bool, error) {
-	unixNameStr := name.ToUnix().ToString()
-
-	remoteName := path.Join(r.Config.Remote.Path, DirContent, unixNameStr+".gz")
-	remoteMetaName := path.Join(r.Config.Remote.Path, DirMeta, unixNameStr)
-
-	if _, err := r.SftpClient.Stat(remoteName); err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		} else {
-			return false, err
-		}
+	remoteMetaName, err := r.remotePath(DirMeta, name, "")
+	if err != nil {
+		return false, err
 	}
 
-	if _, err := r.SftpClient.Stat(remoteMetaName); err != nil {
+	if _, err := r.Backend.Stat(remoteMetaName); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		} else {
@@ -342,8 +472,11 @@ func (r *Remote) existsOnRemote(name paths.Path) (bool, error) {
 
 func (r *Remote) getRemoteMeta(name paths.Path) (Meta, error) {
 	m := Meta{}
-	remoteMetaName := path.Join(r.Config.Remote.Path, DirMeta, name.ToUnix().ToString())
-	f, err := r.SftpClient.Open(remoteMetaName)
+	remoteMetaName, err := r.remotePath(DirMeta, name, "")
+	if err != nil {
+		return m, err
+	}
+	f, err := r.openRemoteFile(remoteMetaName)
 	if err != nil {
 		return m, errors.Join(fmt.Errorf("failed to open remote file %s", remoteMetaName), err)
 	}
@@ -356,101 +489,26 @@ func (r *Remote) getRemoteMeta(name paths.Path) (Meta, error) {
 	return m, nil
 }
 
-func (r *Remote) removeFile(pat paths.Path) error {
-	if options.FlagVerbose {
-		fmt.Printf("removing %s... ", pat)
-		defer fmt.Println()
-	}
-
-	unixName := pat.ToUnix()
-	remoteName := path.Join(r.Config.Remote.Path, DirContent, string(unixName)+".gz")
-	remoteMetaName := path.Join(r.Config.Remote.Path, DirMeta, string(unixName))
-
-	if err := r.SftpClient.Remove(remoteMetaName); err != nil {
-		return errors.Join(fmt.Errorf("failed to remove file %s", remoteMetaName), err)
-	}
-	if err := r.SftpClient.Remove(remoteName); err != nil {
-		return errors.Join(fmt.Errorf("failed to remove file %s", remoteName), err)
-	}
-	return nil
+// objectName returns the remote name of the blob with the given content hash.
+// Blobs are stored by their hash so identical content is only stored once.
+func (r *Remote) objectName(hash []byte) string {
+	return r.objectNameByID(r.objectID(hash))
 }
 
-func (r *Remote) pushFile(pat paths.System) error {
-	if options.FlagVerbose {
-		fmt.Printf("pushing %s... ", pat)
-		defer fmt.Println()
-	}
-
-	unixName := pat.ToUnix()
-
-	remoteDir := path.Join(r.Config.Remote.Path, DirContent, path.Dir(string(unixName)))
-	remoteMetaDir := path.Join(r.Config.Remote.Path, DirMeta, path.Dir(string(unixName)))
-	remoteName := path.Join(r.Config.Remote.Path, DirContent, string(unixName)+".gz")
-	remoteMetaName := path.Join(r.Config.Remote.Path, DirMeta, string(unixName))
-
-	stat, err := pat.Stat()
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to stat file %s", pat), err)
-	}
-
-	f, err := pat.Open()
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open local file %s", pat), err)
-	}
-	defer f.Close()
-
-	if err := r.SftpClient.MkdirAll(remoteDir); err != nil && !os.IsExist(err) {
-		return errors.Join(fmt.Errorf("failed to make directory %s on remote", remoteDir))
-	}
-	if err := r.SftpClient.MkdirAll(remoteMetaDir); err != nil && !os.IsExist(err) {
-		return errors.Join(fmt.Errorf("failed to make directory %s on remote", remoteMetaDir))
-	}
-
-	rf, err := r.SftpClient.Create(remoteName)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open file %s on remote", remoteName))
-	}
-	defer rf.Close()
-
-	gw, err := gzip.NewWriterLevel(rf, gzip.BestCompression)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to open gzip writer for %s on remote", remoteName))
-	}
-	defer gw.Close()
-
-	h := sha256.New()
-
-	mw := io.MultiWriter(h, gw)
-
-	if _, err := io.Copy(mw, f); err != nil {
-		return errors.Join(fmt.Errorf("failed to copy file %s to remote", pat), err)
-	}
-
-	// Close the gzip writer explicitly to ensure all data is flushed
-	if err := gw.Close(); err != nil {
-		return errors.Join(fmt.Errorf("failed to close gzip writer for %s", remoteName), err)
-	}
-
-	hashVal := h.Sum(nil)
-
-	metaFile, err := r.SftpClient.Create(remoteMetaName)
-	if err != nil {
-		return errors.Join(fmt.Errorf("failed to create meta file %s on remote", remoteMetaName), err)
-	}
-	defer metaFile.Close()
-
-	m := Meta{
-		hashVal,
-		user.Name(),
-		stat.ModTime(),
-	}
-	if err := json.NewEncoder(metaFile).Encode(&m); err != nil {
-		return errors.Join(fmt.Errorf("failed to write meta to file %s on remote", remoteMetaName), err)
-	}
+func (r *Remote) objectNameByID(id []byte) string {
+	hexID := hex.EncodeToString(id)
+	return path.Join(r.Config.Remote.Path, DirObjects, hexID[:2], hexID[2:])
+}
 
-	if options.FlagVerbose {
-		fmt.Print("done")
+// blobName returns the remote name of the blob of a file version, respecting the layout of older remotes.
+func (r *Remote) blobName(name paths.Path, m Meta, head bool) string {
+	unixNameStr := name.ToUnix().ToString()
+	switch {
+	case r.Layout >= 4:
+		return r.objectName(m.Hash)
+	case head:
+		return path.Join(r.Config.Remote.Path, DirContent, unixNameStr+".gz")
+	default:
+		return path.Join(r.Config.Remote.Path, DirHistory, unixNameStr+"."+strconv.Itoa(m.Version)+".gz")
 	}
-
-	return nil
 }
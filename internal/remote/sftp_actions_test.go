@@ -0,0 +1,368 @@
+package remote
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// commitableStatus maps the unix paths of the commitable files to their status.
+func commitableStatus(t *testing.T, r *Remote) map[paths.Unix]commitFileStatus {
+	t.Helper()
+
+	commitables, err := r.getCommitable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := make(map[paths.Unix]commitFileStatus, len(commitables))
+	for _, cf := range commitables {
+		status[cf.Path.ToUnix()] = cf.Status
+	}
+	return status
+}
+
+func assertStatus(t *testing.T, got, want map[paths.Unix]commitFileStatus) {
+	t.Helper()
+
+	for name, status := range want {
+		if s, ok := got[name]; !ok {
+			t.Errorf("%s: missing, want %s", name, status.ToString())
+		} else if s != status {
+			t.Errorf("%s: got %s, want %s", name, s.ToString(), status.ToString())
+		}
+	}
+	for name, status := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s: unexpected %s", name, status.ToString())
+		}
+	}
+}
+
+// remoteNames returns the sorted names of all files on the remote.
+func remoteNames(t *testing.T, r *Remote) []paths.Unix {
+	t.Helper()
+
+	metas, err := r.getRemoteMetas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]paths.Unix, 0, len(metas))
+	for name, m := range metas {
+		if !m.Deleted {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestInit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+
+		if err := project.Save(p); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := project.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Remote.Hostname != p.Remote.Hostname || loaded.Remote.Port != p.Remote.Port || loaded.Remote.Path != p.Remote.Path {
+			t.Fatalf("loaded remote %+v, saved %+v", loaded.Remote, p.Remote)
+		}
+		if loaded.Remote.Password != testPassword {
+			t.Fatal("password was not taken from the environment")
+		}
+
+		r := connectTest(t, loaded)
+		if empty, err := r.IsEmpty(); err != nil {
+			t.Fatal(err)
+		} else if !empty {
+			t.Fatal("new remote is not empty")
+		}
+		if r.IsEncrypted() {
+			t.Fatal("new remote is encrypted")
+		}
+
+		writeFile(t, "a.txt", "a")
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if empty, err := r.IsEmpty(); err != nil {
+			t.Fatal(err)
+		} else if empty {
+			t.Fatal("remote is empty after the initial commit")
+		}
+		if layout, err := r.LayoutVersion(); err != nil {
+			t.Fatal(err)
+		} else if layout != project.Version {
+			t.Fatalf("remote layout is %d, want %d", layout, project.Version)
+		}
+		// an empty ignore is not written
+		for _, name := range []string{FileVersion, FileHead} {
+			if _, err := r.Backend.Stat(path.Join(p.Remote.Path, name)); err != nil {
+				t.Errorf("remote has no %s: %s", name, err)
+			}
+		}
+	})
+}
+
+func TestConnectWrongPassword(t *testing.T) {
+	p := newSftpTestProject(t)
+	p.Remote.Password = "wrong"
+
+	if r, err := Connect(p); err == nil {
+		_ = r.Close()
+		t.Fatal("connected with a wrong password")
+	}
+}
+
+func TestInitialCommit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+		writeFile(t, "dir/b.txt", "b")
+		writeFile(t, "dir/sub/c.txt", "c")
+		writeFile(t, "empty.txt", "")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []paths.Unix{"a.txt", "dir/b.txt", "dir/sub/c.txt", "empty.txt"}
+		if got := remoteNames(t, r); !slices.Equal(got, want) {
+			t.Fatalf("remote has %v, want %v", got, want)
+		}
+		assertStatus(t, commitableStatus(t, r), nil)
+
+		// a second working tree gets the same files
+		newWorkTree(t)
+		clone := connectTest(t, p)
+		if err := clone.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c", "empty.txt": ""} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+		assertStatus(t, commitableStatus(t, clone), nil)
+	})
+}
+
+func TestInitialCommitRace(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		// both saw an empty remote before either of them took the push lock
+		first := newWorkTree(t)
+		writeFile(t, "a.txt", "first")
+		r := connectTest(t, p)
+		second := newWorkTree(t)
+		writeFile(t, "a.txt", "second")
+		writeFile(t, "b.txt", "b")
+		other := connectTest(t, p)
+
+		t.Chdir(first)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the second initial commit must not overwrite the first one
+		t.Chdir(second)
+		if err := other.InitialCommit(); err == nil || !strings.Contains(err.Error(), "a.txt was changed") {
+			t.Fatalf("got %v, want a conflict on a.txt", err)
+		}
+		assertStatus(t, commitableStatus(t, other), map[paths.Unix]commitFileStatus{
+			"a.txt": commitFileStatusConflict,
+			"b.txt": commitFileStatusCreate,
+		})
+
+		t.Chdir(first)
+		assertStatus(t, pullableStatus(t, r), nil)
+	})
+}
+
+func TestGetCommitable(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "changed.txt", "old")
+		writeFile(t, "deleted.txt", "deleted")
+		writeFile(t, "dir/unchanged.txt", "unchanged")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		writeFile(t, "changed.txt", "new")
+		if err := os.Remove("deleted.txt"); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "dir/added.txt", "added")
+		// touching a file without changing it is no change
+		writeFile(t, "dir/unchanged.txt", "unchanged")
+
+		assertStatus(t, commitableStatus(t, r), map[paths.Unix]commitFileStatus{
+			"changed.txt":   commitFileStatusChange,
+			"deleted.txt":   commitFileStatusDelete,
+			"dir/added.txt": commitFileStatusCreate,
+		})
+
+		withMessage(t, "second")
+		// a path without changes fails the whole push instead of pushing the others
+		if err := r.CommitPaths([]paths.System{
+			paths.Unix("changed.txt").ToSystem(),
+			paths.Unix("dir/unchanged.txt").ToSystem(),
+		}); err == nil || !strings.Contains(err.Error(), "dir/unchanged.txt matches no changes") {
+			t.Fatalf("got %v, want an error about dir/unchanged.txt", err)
+		}
+		if len(commitableStatus(t, r)) != 3 {
+			t.Fatal("changes were pushed")
+		}
+
+		if err := r.CommitPaths([]paths.System{
+			paths.Unix("changed.txt").ToSystem(),
+			paths.Unix("deleted.txt").ToSystem(),
+			paths.Unix("dir/added.txt").ToSystem(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		assertStatus(t, commitableStatus(t, r), nil)
+		want := []paths.Unix{"changed.txt", "dir/added.txt", "dir/unchanged.txt"}
+		if got := remoteNames(t, r); !slices.Equal(got, want) {
+			t.Fatalf("remote has %v, want %v", got, want)
+		}
+	})
+}
+
+func TestGetCommitableConflict(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		first := newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+		writeFile(t, "b.txt", "b")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		newWorkTree(t)
+		other := connectTest(t, p)
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "a.txt", "changed by other")
+		writeFile(t, "b.txt", "changed by other")
+		withMessage(t, "other")
+		if err := other.CommitPaths([]paths.System{"a.txt", "b.txt"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// only a.txt was changed on both sides
+		t.Chdir(first)
+		writeFile(t, "a.txt", "changed by first")
+
+		assertStatus(t, commitableStatus(t, r), map[paths.Unix]commitFileStatus{
+			"a.txt": commitFileStatusConflict,
+		})
+	})
+}
+
+func TestIgnore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		p.Ignore = "# build output\n*.log\nbuild/\n\n!keep.log\n"
+		newWorkTree(t)
+		if err := project.Save(p); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "main.txt", "main")
+		writeFile(t, "debug.log", "debug")
+		writeFile(t, "keep.log", "keep")
+		writeFile(t, "sub/trace.log", "trace")
+		writeFile(t, "build/out.bin", "out")
+		writeFile(t, "sub/build/out.bin", "out")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the project file and the local state are never committed
+		want := []paths.Unix{"keep.log", "main.txt"}
+		if got := remoteNames(t, r); !slices.Equal(got, want) {
+			t.Fatalf("remote has %v, want %v", got, want)
+		}
+		if ignore, err := r.PullIgnore(); err != nil {
+			t.Fatal(err)
+		} else if ignore != p.Ignore {
+			t.Fatalf("remote ignore is %q, want %q", ignore, p.Ignore)
+		}
+
+		writeFile(t, "new.log", "new")
+		writeFile(t, "build/new.bin", "new")
+		writeFile(t, "new.txt", "new")
+		if err := os.Remove("debug.log"); err != nil {
+			t.Fatal(err)
+		}
+
+		assertStatus(t, commitableStatus(t, r), map[paths.Unix]commitFileStatus{
+			"new.txt": commitFileStatusCreate,
+		})
+	})
+}
+
+func TestPushSelectedRemoteChanged(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		first := newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the changes are checked before the other push lands
+		writeFile(t, "a.txt", "changed by first")
+		commitables, err := r.getCommitable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected := make([]*commitFile, len(commitables))
+		for i := range commitables {
+			selected[i] = &commitables[i]
+		}
+
+		newWorkTree(t)
+		other := connectTest(t, p)
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "a.txt", "changed by other")
+		withMessage(t, "other")
+		if err := other.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Chdir(first)
+		withMessage(t, "first")
+		if err := r.pushSelected(selected); err == nil {
+			t.Fatal("pushed over a change that landed after the diff")
+		}
+	})
+}
@@ -0,0 +1,435 @@
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/user"
+	"github.com/bloodmagesoftware/zet/internal/util"
+)
+
+const (
+	// staging directories without a commit object are left behind by interrupted pushes
+	staleStagingAge = 24 * time.Hour
+	// uploads are kept longer, so they can be resumed
+	staleUploadAge = 7 * 24 * time.Hour
+)
+
+type (
+	Commit struct {
+		ID      string        `json:"id"`
+		Parent  string        `json:"parent,omitempty"`
+		Author  string        `json:"author"`
+		Time    time.Time     `json:"time"`
+		Message string        `json:"message"`
+		Files   []CommitEntry `json:"files"`
+	}
+
+	CommitEntry struct {
+		Path     paths.Unix `json:"path"`
+		Hash     []byte     `json:"hash,omitempty"`
+		LastEdit time.Time  `json:"last_edit"`
+		Deleted  bool       `json:"deleted,omitempty"`
+	}
+)
+
+func newCommitID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// commit uploads all blobs before writing the commit object.
+// The change only becomes visible once the commit object is written, so an interrupted push never leaves a half-applied change set behind.
+// The staging directory marks the commit as in progress until it is fully applied.
+func (r *Remote) commit(files []*commitFile) error {
+	if err := r.checkPushLock(); err != nil {
+		return err
+	}
+
+	if err := r.checkConflicts(files); err != nil {
+		return err
+	}
+
+	if err := r.checkLocks(files); err != nil {
+		return err
+	}
+
+	parent, err := r.Head()
+	if err != nil {
+		return errors.Join(errors.New("failed to get remote head"), err)
+	}
+
+	c := Commit{
+		ID:      newCommitID(),
+		Parent:  parent,
+		Author:  user.Name(),
+		Time:    time.Now(),
+		Message: options.FlagMessage,
+		Files:   make([]CommitEntry, 0, len(files)),
+	}
+
+	stagingDir := path.Join(r.Config.Remote.Path, DirStaging, c.ID)
+	if err := r.Backend.MkdirAll(stagingDir); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s on remote", stagingDir), err)
+	}
+
+	entries := make([]CommitEntry, len(files))
+	var pushes []int
+	for i, cf := range files {
+		status := cf.Status
+		if status == commitFileStatusConflict {
+			// forced, the local side wins
+			if _, err := cf.Path.ToUnix().ToSystem().Stat(); err == nil {
+				status = commitFileStatusChange
+				cf.Path = cf.Path.ToUnix().ToSystem()
+			} else {
+				status = commitFileStatusDelete
+			}
+		}
+
+		switch status {
+		case commitFileStatusCreate, commitFileStatusChange:
+			pushes = append(pushes, i)
+		case commitFileStatusDelete:
+			entries[i] = CommitEntry{
+				Path:     cf.Path.ToUnix(),
+				LastEdit: c.Time,
+				Deleted:  true,
+			}
+		}
+	}
+
+	if err := util.Parallel(len(pushes), options.FlagJobs, func(j int) error {
+		i := pushes[j]
+		if err := context.Cause(r.pushLock.ctx); err != nil {
+			return err
+		}
+		ce, err := r.pushFile(files[i].Path.(paths.System))
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to push %s", files[i].Path.ToString()), err)
+		}
+		entries[i] = ce
+		return nil
+	}); err != nil {
+		// the staging directory is cleaned up by a later recovery
+		return err
+	}
+	c.Files = append(c.Files, entries...)
+
+	// uploaded objects are invisible until the commit is written, the lock must still be held for that
+	if err := r.checkPushLock(); err != nil {
+		return err
+	}
+
+	if err := r.pushCommit(c); err != nil {
+		return errors.Join(fmt.Errorf("failed to push commit %s", c.ID), err)
+	}
+
+	if err := r.applyCommit(c); err != nil {
+		return errors.Join(fmt.Errorf("failed to apply commit %s", c.ID), err)
+	}
+
+	// the pushed state is the new common base of the working tree and the remote
+	for _, ce := range c.Files {
+		if err := r.setBase(ce.Path, ce.Hash); err != nil {
+			return err
+		}
+	}
+	if err := r.saveBase(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkConflicts refuses files that were also changed on the remote since the last sync.
+func (r *Remote) checkConflicts(files []*commitFile) error {
+	if options.FlagForce {
+		return nil
+	}
+
+	var problems []string
+	for _, cf := range files {
+		if cf.Status == commitFileStatusConflict {
+			problems = append(problems, fmt.Sprintf("%s was changed at %s by %s", cf.Path.ToUnix(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor))
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("refusing to overwrite remote changes, pull first or use --force to push anyway\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+// Recover finishes commits that were written but not fully applied by an interrupted push.
+// The caller has to hold the push lock, so no running push is mistaken for an interrupted one.
+func (r *Remote) Recover() error {
+	if err := r.removeStaleUploads(); err != nil {
+		return err
+	}
+	if err := r.removeStaleTemps(); err != nil {
+		return err
+	}
+
+	stagingRoot := path.Join(r.Config.Remote.Path, DirStaging)
+
+	fis, err := r.Backend.ReadDir(stagingRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Join(fmt.Errorf("failed to read directory %s", stagingRoot), err)
+	}
+
+	for _, fi := range fis {
+		c, err := r.GetCommit(fi.Name())
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return errors.Join(fmt.Errorf("failed to get commit %s", fi.Name()), err)
+			}
+
+			// the push never finished uploading, nothing of it is visible
+			if time.Since(fi.ModTime()) > staleStagingAge {
+				stagingDir := path.Join(stagingRoot, fi.Name())
+				if err := r.Backend.RemoveAll(stagingDir); err != nil {
+					return errors.Join(fmt.Errorf("failed to remove stale directory %s", stagingDir), err)
+				}
+			}
+			continue
+		}
+
+		if options.FlagVerbose {
+			fmt.Printf("recovering interrupted commit %s\n", c.ID)
+		}
+		if err := r.applyCommit(c); err != nil {
+			return errors.Join(fmt.Errorf("failed to apply commit %s", c.ID), err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Remote) removeStaleUploads() error {
+	uploadsRoot := path.Join(r.Config.Remote.Path, DirUploads)
+
+	fis, err := r.Backend.ReadDir(uploadsRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Join(fmt.Errorf("failed to read directory %s", uploadsRoot), err)
+	}
+
+	for _, fi := range fis {
+		if time.Since(fi.ModTime()) <= staleUploadAge && !r.isMovedUpload(fi.Name()) {
+			continue
+		}
+		uploadName := path.Join(uploadsRoot, fi.Name())
+		if err := r.Backend.Remove(uploadName); err != nil && !os.IsNotExist(err) {
+			return errors.Join(fmt.Errorf("failed to remove stale file %s", uploadName), err)
+		}
+	}
+
+	return nil
+}
+
+// isMovedUpload reports if the object of the upload exists, so the upload is left over from a rename that copied it
+// but failed to remove the upload. Nothing uploads while the push lock is held, so such an upload is never in use.
+func (r *Remote) isMovedUpload(uploadName string) bool {
+	hexID, _, _ := strings.Cut(uploadName, ".")
+	id, err := hex.DecodeString(hexID)
+	if err != nil || len(id) == 0 {
+		return false
+	}
+	_, err = r.Backend.Stat(r.objectNameByID(id))
+	return err == nil
+}
+
+// applyCommit updates meta and history of every file in the commit.
+// It is safe to call it again after an interruption.
+func (r *Remote) applyCommit(c Commit) error {
+	metas := make(map[paths.Unix]Meta, len(c.Files))
+	for _, ce := range c.Files {
+		m, err := r.applyEntry(c, ce)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to apply %s", ce.Path), err)
+		}
+		metas[ce.Path] = m
+	}
+
+	if err := r.updateManifest(c, metas); err != nil {
+		return errors.Join(errors.New("failed to update manifest"), err)
+	}
+
+	if err := r.checkPushLock(); err != nil {
+		return err
+	}
+	if err := r.pushHead(c.ID); err != nil {
+		return errors.Join(errors.New("failed to push head"), err)
+	}
+
+	stagingDir := path.Join(r.Config.Remote.Path, DirStaging, c.ID)
+	if err := r.Backend.RemoveAll(stagingDir); err != nil && !os.IsNotExist(err) {
+		return errors.Join(fmt.Errorf("failed to remove directory %s", stagingDir), err)
+	}
+
+	return nil
+}
+
+func (r *Remote) applyEntry(c Commit, ce CommitEntry) (Meta, error) {
+	history, err := r.History(ce.Path)
+	if err != nil {
+		return Meta{}, errors.Join(fmt.Errorf("failed to get history of %s", ce.Path), err)
+	}
+
+	if len(history) != 0 && history[len(history)-1].Commit == c.ID {
+		// applied by an earlier attempt
+		return history[len(history)-1], nil
+	}
+
+	remoteMetaName, err := r.remotePath(DirMeta, ce.Path, "")
+	if err != nil {
+		return Meta{}, err
+	}
+
+	m := Meta{
+		Hash:       ce.Hash,
+		LastEditor: c.Author,
+		LastEdit:   ce.LastEdit,
+		Version:    nextVersion(history),
+		Deleted:    ce.Deleted,
+		Commit:     c.ID,
+	}
+
+	if ce.Deleted {
+		// the blob stays in the objects, so the history can still restore it
+		if err := r.Backend.Remove(remoteMetaName); err != nil && !os.IsNotExist(err) {
+			return m, errors.Join(fmt.Errorf("failed to remove file %s", remoteMetaName), err)
+		}
+	} else {
+		// the object was uploaded before the commit, so the meta never points to incomplete content
+		if err := r.writeRemoteJson(remoteMetaName, &m); err != nil {
+			return m, errors.Join(fmt.Errorf("failed to write meta to file %s on remote", remoteMetaName), err)
+		}
+	}
+
+	if err := r.pushHistory(ce.Path, append(history, m)); err != nil {
+		return m, errors.Join(fmt.Errorf("failed to push history of %s", ce.Path), err)
+	}
+
+	return m, nil
+}
+
+func (r *Remote) pushCommit(c Commit) error {
+	remoteCommitName := path.Join(r.Config.Remote.Path, DirCommits, c.ID+".json")
+
+	// readers either see the complete commit or none
+	if err := r.writeRemoteJson(remoteCommitName, &c); err != nil {
+		return errors.Join(fmt.Errorf("failed to write commit to file %s on remote", remoteCommitName), err)
+	}
+
+	return nil
+}
+
+func (r *Remote) GetCommit(id string) (Commit, error) {
+	c := Commit{}
+	remoteCommitName := path.Join(r.Config.Remote.Path, DirCommits, id+".json")
+
+	f, err := r.openRemoteFile(remoteCommitName)
+	if err != nil {
+		return c, errors.Join(fmt.Errorf("failed to open remote file %s", remoteCommitName), err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return c, errors.Join(fmt.Errorf("failed to read remote file %s", remoteCommitName), err)
+	}
+
+	return c, nil
+}
+
+// Head returns the id of the last applied commit, remotes without commits return an empty string.
+func (r *Remote) Head() (string, error) {
+	remoteName := path.Join(r.Config.Remote.Path, FileHead)
+
+	f, err := r.openRemoteFile(remoteName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Join(fmt.Errorf("failed to open remote file %s", remoteName), err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to read remote file %s", remoteName), err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (r *Remote) pushHead(id string) error {
+	remoteName := path.Join(r.Config.Remote.Path, FileHead)
+
+	if err := r.writeRemoteFile(remoteName, func(w io.Writer) error {
+		_, err := io.WriteString(w, id)
+		return err
+	}); err != nil {
+		return errors.Join(errors.New("failed to write head to remote"), err)
+	}
+
+	return nil
+}
+
+func (r *Remote) PrintCommits() error {
+	id, err := r.Head()
+	if err != nil {
+		return errors.Join(errors.New("failed to get remote head"), err)
+	}
+
+	if id == "" {
+		fmt.Println("no commits on remote")
+		return nil
+	}
+
+	for id != "" {
+		c, err := r.GetCommit(id)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to get commit %s", id), err)
+		}
+
+		fmt.Printf("commit %s\n", c.ID)
+		fmt.Printf("Author: %s\n", c.Author)
+		fmt.Printf("Date:   %s\n\n", c.Time.Format(time.UnixDate))
+		if c.Message != "" {
+			fmt.Printf("    %s\n\n", strings.ReplaceAll(c.Message, "\n", "\n    "))
+		}
+		for _, ce := range c.Files {
+			if ce.Deleted {
+				fmt.Printf("    DELETE %s\n", ce.Path)
+			} else {
+				fmt.Printf("    PUSH   %s\n", ce.Path)
+			}
+		}
+		fmt.Println()
+
+		id = c.Parent
+	}
+
+	return nil
+}
@@ -0,0 +1,390 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/bloodmagesoftware/zet/internal/crypt"
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/charmbracelet/huh"
+)
+
+// FileKey holds the wrapped master key of an encrypted remote, it is the only file that is never encrypted besides the version
+const FileKey = "key.json"
+
+func (r *Remote) IsEncrypted() bool {
+	return r.key != nil
+}
+
+// isPlain reports if the remote file name is readable without the key.
+func (r *Remote) isPlain(name string) bool {
+	rel, err := paths.Unix(name).Rel(r.Config.Remote.Path)
+	return r.key == nil || err != nil || rel == FileVersion || rel == FileKey
+}
+
+// remotePath returns the remote name of a file of the working tree below dir.
+// On encrypted remotes, every path component is encrypted.
+func (r *Remote) remotePath(dir string, name paths.Path, suffix string) (string, error) {
+	unixName := name.ToUnix().ToString()
+	if r.key != nil {
+		var err error
+		if unixName, err = r.key.EncryptPath(unixName); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(r.Config.Remote.Path, dir, unixName+suffix), nil
+}
+
+// decodePath reverses remotePath for a name relative to its dir, without the suffix.
+func (r *Remote) decodePath(rel paths.Unix) (paths.Unix, error) {
+	if r.key == nil {
+		return rel, nil
+	}
+	plain, err := r.key.DecryptPath(string(rel))
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to decrypt name %s", rel), err)
+	}
+	return paths.Unix(plain), nil
+}
+
+// objectID is the name of the object with the given content hash.
+// On encrypted remotes, it doesn't reveal the hash, so nobody can tell which known content is stored.
+func (r *Remote) objectID(hash []byte) []byte {
+	if r.key == nil {
+		return hash
+	}
+	return r.key.ObjectID(hash)
+}
+
+// openRemoteFile opens a remote file for reading and decrypts it if needed.
+// Errors of opening the file are returned unwrapped, so they can be checked with os.IsNotExist.
+func (r *Remote) openRemoteFile(name string) (io.ReadCloser, error) {
+	f, err := r.Backend.Open(name)
+	if err != nil || r.isPlain(name) {
+		return f, err
+	}
+	defer f.Close()
+
+	sealed, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", name), err)
+	}
+
+	plain, err := r.key.OpenFile(r.sealName(name), sealed)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to decrypt remote file %s", name), err)
+	}
+
+	return io.NopCloser(bytes.NewReader(plain)), nil
+}
+
+// sealing returns a write function that encrypts the output of write if the remote file name has to be encrypted.
+func (r *Remote) sealing(name string, write func(w io.Writer) error) func(w io.Writer) error {
+	if r.isPlain(name) {
+		return write
+	}
+	return func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		_, err := w.Write(r.key.SealFile(r.sealName(name), buf.Bytes()))
+		return err
+	}
+}
+
+// sealName binds encrypted files to their name relative to the remote root, which doesn't change when the remote moves.
+func (r *Remote) sealName(name string) string {
+	rel, _ := paths.Unix(name).Rel(r.Config.Remote.Path)
+	return string(rel)
+}
+
+// getWrappedKey returns the wrapped master key or nil if the remote is not encrypted.
+func (r *Remote) getWrappedKey() (*crypt.Wrapped, error) {
+	remoteName := path.Join(r.Config.Remote.Path, FileKey)
+
+	f, err := r.Backend.Open(remoteName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteName), err)
+	}
+	defer f.Close()
+
+	w := &crypt.Wrapped{}
+	if err := json.NewDecoder(f).Decode(w); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", remoteName), err)
+	}
+
+	return w, nil
+}
+
+// loadKey unlocks an encrypted remote with the key file of the project or its passphrase.
+// The passphrase is taken from ZET_PASSPHRASE, the keyring and finally a prompt, in that order.
+func (r *Remote) loadKey() error {
+	w, err := r.getWrappedKey()
+	if err != nil || w == nil {
+		return err
+	}
+
+	if w.KDF == crypt.KDFKeyFile {
+		if r.Config.EncryptionKeyFile == "" {
+			return fmt.Errorf("remote is encrypted with a key file, set encryption_key_file in %s", project.ProjectFileName)
+		}
+		secret, err := crypt.ReadKeyFile(util.ExpandHome(r.Config.EncryptionKeyFile))
+		if err != nil {
+			return err
+		}
+		if r.key, err = w.Unwrap(secret); err != nil {
+			return errors.Join(fmt.Errorf("failed to unlock remote with key file %s", r.Config.EncryptionKeyFile), err)
+		}
+		return nil
+	}
+
+	if passphrase, source := r.Config.StoredPassphrase(); source != "" {
+		if r.key, err = w.Unwrap([]byte(passphrase)); err == nil {
+			return nil
+		}
+		if source == project.EnvPassphrase {
+			return errors.Join(fmt.Errorf("failed to unlock remote with %s", project.EnvPassphrase), err)
+		}
+		fmt.Fprintf(os.Stderr, "the passphrase in the %s does not unlock the remote anymore\n", source)
+	}
+
+	if !util.IsInteractive() {
+		return fmt.Errorf("remote is encrypted, set %s to unlock it without a terminal", project.EnvPassphrase)
+	}
+
+	var passphrase string
+	remember := false
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title(fmt.Sprintf("Passphrase of %s", r.Config.Remote.Path)).
+			EchoMode(huh.EchoModePassword).
+			Value(&passphrase),
+		huh.NewConfirm().
+			Title("Remember the passphrase in the keyring?").
+			Value(&remember),
+	)).Run(); err != nil {
+		return err
+	}
+
+	if r.key, err = w.Unwrap([]byte(passphrase)); err != nil {
+		return errors.Join(errors.New("failed to unlock remote"), err)
+	}
+
+	if remember {
+		if err := r.Config.StorePassphrase(passphrase); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remember passphrase, set %s instead: %s\n", project.EnvPassphrase, err)
+		}
+	}
+
+	return nil
+}
+
+// EnableEncryption encrypts everything that is pushed to the remote from now on, it must still be empty.
+// The secret is a passphrase or the content of a key file, depending on kdf.
+func (r *Remote) EnableEncryption(kdf crypt.KDF, secret []byte) error {
+	if empty, err := r.IsEmpty(); err != nil {
+		return errors.Join(errors.New("failed to check if remote directory is empty"), err)
+	} else if !empty {
+		return errors.New("encryption can only be enabled for empty remotes")
+	}
+
+	key, err := crypt.NewKey(crypt.NewMasterKey())
+	if err != nil {
+		return err
+	}
+
+	if err := r.pushWrappedKey(key, kdf, secret); err != nil {
+		return err
+	}
+	r.key = key
+
+	if options.FlagVerbose {
+		fmt.Println("enabled encryption")
+	}
+
+	return nil
+}
+
+// ChangePassphrase changes the passphrase or key file that unlocks the remote.
+// Only the wrapping of the master key changes, the data stays encrypted with the same master key,
+// so this does not revoke access: whoever could unlock the remote before may have kept the master key
+// or a copy of the old key file on the remote, which still decrypt everything.
+func (r *Remote) ChangePassphrase(kdf crypt.KDF, secret []byte) error {
+	if r.key == nil {
+		return errors.New("remote is not encrypted")
+	}
+
+	unlock, err := r.lockPush()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return r.pushWrappedKey(r.key, kdf, secret)
+}
+
+func (r *Remote) pushWrappedKey(key *crypt.Key, kdf crypt.KDF, secret []byte) error {
+	w, err := key.Wrap(kdf, secret)
+	if err != nil {
+		return errors.Join(errors.New("failed to wrap key"), err)
+	}
+
+	remoteName := path.Join(r.Config.Remote.Path, FileKey)
+	if err := r.writeRemoteJson(remoteName, &w); err != nil {
+		return errors.Join(errors.New("failed to write key to remote"), err)
+	}
+
+	return nil
+}
+
+// objectIDString is the hex encoded object id, as used in messages and by verify.
+func (r *Remote) objectIDString(hash []byte) string {
+	return hex.EncodeToString(r.objectID(hash))
+}
+
+// EnableEncryptionInteractive asks if the remote should be encrypted and how it is unlocked.
+// A chosen key file is set in the config of the remote, so the project file has to be saved afterwards.
+func (r *Remote) EnableEncryptionInteractive() error {
+	method := crypt.KDF("")
+	var passphrase, keyFile string
+	remember := true
+
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewSelect[crypt.KDF]().
+			Title("Encryption").
+			Description("Encrypted remotes can only be read with the passphrase or key file").
+			Value(&method).
+			Options(
+				huh.Option[crypt.KDF]{Key: "None", Value: ""},
+				huh.Option[crypt.KDF]{Key: "Passphrase", Value: crypt.KDFPassphrase},
+				huh.Option[crypt.KDF]{Key: "Key file", Value: crypt.KDFKeyFile},
+			),
+	), huh.NewGroup(
+		newPassphraseInputs(&passphrase)...,
+	).WithHideFunc(func() bool {
+		return method != crypt.KDFPassphrase
+	}), huh.NewGroup(
+		huh.NewConfirm().
+			Title("Remember the passphrase in the keyring?").
+			Value(&remember),
+	).WithHideFunc(func() bool {
+		return method != crypt.KDFPassphrase
+	}), huh.NewGroup(
+		huh.NewInput().
+			Title("Key file").
+			Description("It is created if it does not exist, share it with everyone who needs access").
+			Validate(notEmpty).
+			Value(&keyFile),
+	).WithHideFunc(func() bool {
+		return method != crypt.KDFKeyFile
+	})).Run(); err != nil {
+		return err
+	}
+
+	switch method {
+	case crypt.KDFPassphrase:
+		if err := r.EnableEncryption(crypt.KDFPassphrase, []byte(passphrase)); err != nil {
+			return err
+		}
+		if remember {
+			if err := r.Config.StorePassphrase(passphrase); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to remember passphrase, set %s instead: %s\n", project.EnvPassphrase, err)
+			}
+		}
+	case crypt.KDFKeyFile:
+		secret, err := crypt.CreateKeyFile(util.ExpandHome(keyFile))
+		if err != nil {
+			return err
+		}
+		if err := r.EnableEncryption(crypt.KDFKeyFile, secret); err != nil {
+			return err
+		}
+		r.Config.EncryptionKeyFile = keyFile
+	}
+
+	return nil
+}
+
+// ChangePassphraseInteractive unlocks the remote with keyFile from now on, or with a new passphrase if keyFile is empty.
+// The key file is set in the config of the remote, so the project file has to be saved afterwards.
+func (r *Remote) ChangePassphraseInteractive(keyFile string) error {
+	if keyFile != "" {
+		secret, err := crypt.CreateKeyFile(util.ExpandHome(keyFile))
+		if err != nil {
+			return err
+		}
+		if err := r.ChangePassphrase(crypt.KDFKeyFile, secret); err != nil {
+			return err
+		}
+		r.Config.EncryptionKeyFile = keyFile
+		return nil
+	}
+
+	if !util.IsInteractive() {
+		return errors.New("a new passphrase can only be entered in a terminal, use a key file instead")
+	}
+
+	var passphrase string
+	if err := huh.NewForm(huh.NewGroup(
+		newPassphraseInputs(&passphrase)...,
+	)).Run(); err != nil {
+		return err
+	}
+
+	_, source := r.Config.StoredPassphrase()
+	if err := r.ChangePassphrase(crypt.KDFPassphrase, []byte(passphrase)); err != nil {
+		return err
+	}
+	r.Config.EncryptionKeyFile = ""
+
+	switch source {
+	case "keyring":
+		if err := r.Config.StorePassphrase(passphrase); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to update passphrase in the keyring: %s\n", err)
+		}
+	case project.EnvPassphrase:
+		fmt.Fprintf(os.Stderr, "update %s to the new passphrase\n", project.EnvPassphrase)
+	}
+
+	return nil
+}
+
+// newPassphraseInputs asks for a new passphrase twice, so a typo doesn't lock everyone out.
+func newPassphraseInputs(passphrase *string) []huh.Field {
+	return []huh.Field{
+		huh.NewInput().
+			Title("Passphrase").
+			EchoMode(huh.EchoModePassword).
+			Validate(notEmpty).
+			Value(passphrase),
+		huh.NewInput().
+			Title("Repeat passphrase").
+			EchoMode(huh.EchoModePassword).
+			Validate(func(s string) error {
+				if s != *passphrase {
+					return errors.New("passphrases do not match")
+				}
+				return nil
+			}),
+	}
+}
+
+func notEmpty(s string) error {
+	if s == "" {
+		return errors.New("must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package remote
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/crypt"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// assertOpaque fails if a file on the remote contains one of the secrets.
+func assertOpaque(t *testing.T, r *Remote, secrets ...string) {
+	t.Helper()
+
+	walker := r.Backend.Walk(r.Config.Remote.Path)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(walker.Path(), secret) {
+				t.Errorf("remote file name %s contains %q", walker.Path(), secret)
+			}
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+		content := readRemote(t, r.Backend, walker.Path())
+		for _, secret := range secrets {
+			if bytes.Contains(content, []byte(secret)) {
+				t.Errorf("remote file %s contains %q", walker.Path(), secret)
+			}
+		}
+	}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		t.Setenv(project.EnvPassphrase, "correct horse")
+
+		first := newWorkTree(t)
+		writeFile(t, "secret-name.txt", "secret content")
+		writeFile(t, "dir/other-name.txt", "other content")
+
+		r := connectTest(t, p)
+		if err := r.EnableEncryption(crypt.KDFPassphrase, []byte("correct horse")); err != nil {
+			t.Fatal(err)
+		}
+		withMessage(t, "secret message")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// a new connection unlocks the remote with the passphrase from the environment
+		second := newWorkTree(t)
+		other := connectTest(t, p)
+		if !other.IsEncrypted() {
+			t.Fatal("remote is not encrypted")
+		}
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"secret-name.txt": "secret content", "dir/other-name.txt": "other content"} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+
+		t.Chdir(first)
+		writeFile(t, "secret-name.txt", "changed content")
+		withMessage(t, "second")
+		if err := r.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Chdir(second)
+		assertStatus(t, pullableStatus(t, other), map[paths.Unix]commitFileStatus{
+			"secret-name.txt": commitFileStatusChange,
+		})
+		pullAll(t, other)
+		if got := readFile(t, "secret-name.txt"); got != "changed content" {
+			t.Errorf("secret-name.txt: got %q, want %q", got, "changed content")
+		}
+
+		assertOpaque(t, r, "secret-name", "other-name", "secret content", "changed content", "secret message")
+
+		t.Setenv(project.EnvPassphrase, "wrong")
+		if _, err := Connect(p); err == nil {
+			t.Fatal("connected with the wrong passphrase")
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bloodmagesoftware/zet/internal/ignore"
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/state"
+)
+
+type fileDiff struct {
+	Path   paths.Unix
+	Local  []byte
+	Remote *Meta
+	Base   []byte
+	// LocalStatus is the change made in the working tree since the last sync, nil if there is none
+	LocalStatus *commitFileStatus
+	// RemoteStatus is the change made on the remote since the last sync, nil if there is none
+	RemoteStatus *commitFileStatus
+}
+
+func (fd fileDiff) IsConflict() bool {
+	return fd.LocalStatus != nil && fd.RemoteStatus != nil
+}
+
+// diff compares the working tree, the remote and the state of the last sync.
+// Files without a known base are treated as never synced, if such a file differs between both sides it is a conflict.
+func (r *Remote) diff() ([]fileDiff, error) {
+	ignoreMatcher := ignore.GetMatcher(r.Config)
+
+	base, err := r.getBase()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load sync state"), err)
+	}
+
+	if options.FlagVerbose {
+		fmt.Println("checking local files for changes")
+	}
+
+	localFiles, err := r.localHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	// read before the metas, so a push that lands while they are read moves the head away from it
+	if r.diffHead, err = r.Head(); err != nil {
+		return nil, errors.Join(errors.New("failed to get remote head"), err)
+	}
+
+	remoteFiles := make(map[paths.Unix]*Meta)
+
+	if options.FlagVerbose {
+		fmt.Println("checking remote files for changes")
+	}
+
+	metas, err := r.getRemoteMetas()
+	if err != nil {
+		return nil, err
+	}
+	for unixPath, rm := range metas {
+		if ignoreMatcher.Match(unixPath.ToGit(), false) {
+			continue
+		}
+		remoteFiles[unixPath] = &rm
+	}
+
+	var diffs []fileDiff
+
+	for unixPath, lh := range localFiles {
+		rm := remoteFiles[unixPath]
+		if rm != nil && bytes.Equal(rm.Hash, lh) {
+			// in sync, also heals working trees that were synced before the base was tracked
+			base[unixPath] = lh
+			continue
+		}
+		diffs = append(diffs, newFileDiff(unixPath, lh, rm, base[unixPath]))
+	}
+	for unixPath, rm := range remoteFiles {
+		if _, ok := localFiles[unixPath]; ok {
+			continue
+		}
+		diffs = append(diffs, newFileDiff(unixPath, nil, rm, base[unixPath]))
+	}
+	for unixPath := range base {
+		_, isLocal := localFiles[unixPath]
+		_, isRemote := remoteFiles[unixPath]
+		if !isLocal && !isRemote {
+			// deleted on both sides
+			delete(base, unixPath)
+		}
+	}
+
+	slices.SortFunc(diffs, func(a, b fileDiff) int {
+		return strings.Compare(string(a.Path), string(b.Path))
+	})
+
+	return diffs, nil
+}
+
+// localHashes returns the hashes of all files in the working tree that are not ignored.
+func (r *Remote) localHashes() (map[paths.Unix][]byte, error) {
+	ignoreMatcher := ignore.GetMatcher(r.Config)
+
+	index, err := state.LoadIndex()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to load index"), err)
+	}
+
+	localFiles := make(map[paths.Unix][]byte)
+
+	if err := paths.WalkDir(".", func(sysPath paths.System, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		gitPath := sysPath.ToGit()
+
+		isDir := d.IsDir()
+		if ignoreMatcher.Match(gitPath, isDir) {
+			// excluded from ignore
+			if isDir {
+				return filepath.SkipDir
+			} else {
+				return nil
+			}
+		}
+		if isDir {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to stat file %s", sysPath), err)
+		}
+
+		lh, err := index.Hash(sysPath, fi)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to get hash from %s", sysPath), err)
+		}
+		localFiles[sysPath.ToUnix()] = lh
+
+		return nil
+	}); err != nil {
+		return nil, errors.Join(errors.New("failed to walk repo dir"), err)
+	}
+
+	index.Prune(localFiles)
+	if err := index.Save(); err != nil {
+		return nil, errors.Join(errors.New("failed to save index"), err)
+	}
+
+	return localFiles, nil
+}
+
+func newFileDiff(unixPath paths.Unix, lh []byte, rm *Meta, bh []byte) fileDiff {
+	fd := fileDiff{
+		Path:   unixPath,
+		Local:  lh,
+		Remote: rm,
+		Base:   bh,
+	}
+
+	var localStatus, remoteStatus commitFileStatus
+
+	switch {
+	case bh == nil && rm == nil:
+		localStatus = commitFileStatusCreate
+		fd.LocalStatus = &localStatus
+	case bh == nil && lh == nil:
+		remoteStatus = commitFileStatusCreate
+		fd.RemoteStatus = &remoteStatus
+	case bh == nil:
+		// never synced but on both sides, nothing tells which side is newer
+		if !bytes.Equal(lh, rm.Hash) {
+			localStatus = commitFileStatusChange
+			remoteStatus = commitFileStatusChange
+			fd.LocalStatus = &localStatus
+			fd.RemoteStatus = &remoteStatus
+		}
+	default:
+		if lh == nil {
+			localStatus = commitFileStatusDelete
+			fd.LocalStatus = &localStatus
+		} else if !bytes.Equal(lh, bh) {
+			localStatus = commitFileStatusChange
+			fd.LocalStatus = &localStatus
+		}
+		if rm == nil {
+			remoteStatus = commitFileStatusDelete
+			fd.RemoteStatus = &remoteStatus
+		} else if !bytes.Equal(rm.Hash, bh) {
+			remoteStatus = commitFileStatusChange
+			fd.RemoteStatus = &remoteStatus
+		}
+	}
+
+	return fd
+}
+
+func (r *Remote) getBase() (state.Base, error) {
+	if r.base == nil {
+		var err error
+		if r.base, err = state.LoadBase(); err != nil {
+			return nil, err
+		}
+	}
+	return r.base, nil
+}
+
+func (r *Remote) setBase(name paths.Unix, hash []byte) error {
+	base, err := r.getBase()
+	if err != nil {
+		return errors.Join(errors.New("failed to load sync state"), err)
+	}
+	if hash == nil {
+		delete(base, name)
+	} else {
+		base[name] = hash
+	}
+	return nil
+}
+
+func (r *Remote) saveBase() error {
+	if r.base == nil {
+		return nil
+	}
+	if err := r.base.Save(); err != nil {
+		return errors.Join(errors.New("failed to save sync state"), err)
+	}
+	return nil
+}
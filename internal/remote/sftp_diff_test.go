@@ -0,0 +1,83 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+func TestNewFileDiff(t *testing.T) {
+	create, change, del := commitFileStatusCreate, commitFileStatusChange, commitFileStatusDelete
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	for _, tc := range []struct {
+		name         string
+		local        []byte
+		remote       []byte
+		base         []byte
+		localStatus  *commitFileStatus
+		remoteStatus *commitFileStatus
+	}{
+		{"created locally", a, nil, nil, &create, nil},
+		{"created on remote", nil, a, nil, nil, &create},
+		{"never synced and equal", a, a, nil, nil, nil},
+		{"never synced and different", a, b, nil, &change, &change},
+		{"changed locally", b, a, a, &change, nil},
+		{"changed on remote", a, b, a, nil, &change},
+		{"changed on both sides", b, c, a, &change, &change},
+		{"deleted locally", nil, a, a, &del, nil},
+		{"deleted on remote", a, nil, a, nil, &del},
+		{"changed locally and deleted on remote", b, nil, a, &change, &del},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var rm *Meta
+			if tc.remote != nil {
+				rm = &Meta{Hash: tc.remote}
+			}
+			fd := newFileDiff("file", tc.local, rm, tc.base)
+
+			if !equalStatus(fd.LocalStatus, tc.localStatus) {
+				t.Errorf("local status %s, want %s", statusString(fd.LocalStatus), statusString(tc.localStatus))
+			}
+			if !equalStatus(fd.RemoteStatus, tc.remoteStatus) {
+				t.Errorf("remote status %s, want %s", statusString(fd.RemoteStatus), statusString(tc.remoteStatus))
+			}
+		})
+	}
+}
+
+func TestGetCommitableWithoutBase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "same.txt", "same")
+		writeFile(t, "different.txt", "remote")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// a working tree with the same files that was never synced
+		newWorkTree(t)
+		writeFile(t, "same.txt", "same")
+		writeFile(t, "different.txt", "local")
+		other := connectTest(t, p)
+
+		assertStatus(t, commitableStatus(t, other), map[paths.Unix]commitFileStatus{
+			"different.txt": commitFileStatusConflict,
+		})
+	})
+}
+
+func equalStatus(a, b *commitFileStatus) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func statusString(s *commitFileStatus) string {
+	if s == nil {
+		return "none"
+	}
+	return s.ToString()
+}
@@ -0,0 +1,198 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// History returns every known version of a file, oldest first.
+// Files pushed by a layout version 1 client only know their current version.
+func (r *Remote) History(name paths.Path) ([]Meta, error) {
+	unixNameStr := name.ToUnix().ToString()
+	remoteLogName, err := r.remotePath(DirHistory, name, ".log")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := r.openRemoteFile(remoteLogName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteLogName), err)
+		}
+
+		// no log yet, the current meta is the only known version
+		if exists, err := r.existsOnRemote(name); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to check if file %s exists on remote", unixNameStr), err)
+		} else if !exists {
+			return nil, nil
+		}
+		m, err := r.getRemoteMeta(name)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to get remote meta from %s", unixNameStr), err)
+		}
+		if m.Version == 0 {
+			m.Version = 1
+		}
+		return []Meta{m}, nil
+	}
+	defer f.Close()
+
+	var history []Meta
+	if err := json.NewDecoder(f).Decode(&history); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", remoteLogName), err)
+	}
+
+	return history, nil
+}
+
+func (r *Remote) PrintHistory(name paths.Path) error {
+	history, err := r.History(name)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		return fmt.Errorf("file %s has no history on remote", name.ToString())
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		m := history[i]
+		if m.Deleted {
+			fmt.Printf("v%-4d %s deleted by %s\n", m.Version, m.LastEdit.Format(time.UnixDate), m.LastEditor)
+		} else {
+			fmt.Printf("v%-4d %s changed by %s sha256:%x\n", m.Version, m.LastEdit.Format(time.UnixDate), m.LastEditor, m.Hash)
+		}
+		if m.Commit != "" {
+			c, err := r.GetCommit(m.Commit)
+			if err != nil {
+				return errors.Join(fmt.Errorf("failed to get commit %s", m.Commit), err)
+			}
+			if c.Message != "" {
+				fmt.Printf("      %s\n", strings.ReplaceAll(c.Message, "\n", "\n      "))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Restore downloads the given version of a file into the local working tree.
+func (r *Remote) Restore(name paths.Path, version int) error {
+	history, err := r.History(name)
+	if err != nil {
+		return err
+	}
+
+	var (
+		m     Meta
+		found bool
+	)
+	for _, hm := range history {
+		// version 0 selects the latest version that still has content
+		if hm.Version == version || (version == 0 && !hm.Deleted) {
+			m = hm
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("version %d of %s not found on remote", version, name.ToString())
+	}
+	version = m.Version
+	if m.Deleted {
+		return fmt.Errorf("version %d of %s is a deletion", version, name.ToString())
+	}
+
+	unixNameStr := name.ToUnix().ToString()
+	remoteName := r.blobName(name, m, history[len(history)-1].Version == version)
+
+	if options.FlagVerbose {
+		fmt.Printf("restoring %s version %d... ", unixNameStr, version)
+		defer fmt.Println()
+	}
+
+	if err := r.downloadFile(remoteName, name.ToUnix().ToSystem(), m); err != nil {
+		return err
+	}
+
+	if options.FlagVerbose {
+		fmt.Print("done")
+	}
+
+	return nil
+}
+
+func nextVersion(history []Meta) int {
+	if len(history) == 0 {
+		return 1
+	}
+	return history[len(history)-1].Version + 1
+}
+
+func (r *Remote) pushHistory(name paths.Path, history []Meta) error {
+	remoteLogName, err := r.remotePath(DirHistory, name, ".log")
+	if err != nil {
+		return err
+	}
+
+	if err := r.writeRemoteJson(remoteLogName, history); err != nil {
+		return errors.Join(fmt.Errorf("failed to write history to file %s on remote", remoteLogName), err)
+	}
+
+	return nil
+}
+
+// LayoutVersion returns the layout version of the remote.
+// Remotes without a version file use version 1, unless they are empty and will get the current layout.
+func (r *Remote) LayoutVersion() (int, error) {
+	remoteName := path.Join(r.Config.Remote.Path, FileVersion)
+
+	f, err := r.Backend.Open(remoteName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if empty, err := r.IsEmpty(); err != nil {
+				return 0, err
+			} else if empty {
+				return project.Version, nil
+			}
+			return 1, nil
+		}
+		return 0, errors.Join(fmt.Errorf("failed to open remote file %s", remoteName), err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("failed to read remote file %s", remoteName), err)
+	}
+
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, errors.Join(fmt.Errorf("failed to parse remote file %s", remoteName), err)
+	}
+
+	return v, nil
+}
+
+func (r *Remote) pushVersion() error {
+	remoteName := path.Join(r.Config.Remote.Path, FileVersion)
+
+	if err := r.writeRemoteFile(remoteName, func(w io.Writer) error {
+		_, err := io.WriteString(w, strconv.Itoa(project.Version))
+		return err
+	}); err != nil {
+		return errors.Join(errors.New("failed to write version to remote"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+func TestRestoreAndLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "first")
+
+		r := connectTest(t, p)
+		withMessage(t, "add a")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "a.txt", "second")
+		withMessage(t, "change a")
+		if err := r.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		withMessage(t, "delete a")
+		if err := r.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		name := paths.System("a.txt")
+		history, err := r.History(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 3 {
+			t.Fatalf("got %d versions, want 3", len(history))
+		}
+		for i, m := range history {
+			if m.Version != i+1 || m.Deleted != (i == 2) {
+				t.Errorf("version %d: got version %d, deleted %v", i+1, m.Version, m.Deleted)
+			}
+		}
+
+		// the commits are linked from the head back to the initial commit
+		id, err := r.Head()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages []string
+		for i := len(history) - 1; id != ""; i-- {
+			c, err := r.GetCommit(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i >= 0 && history[i].Commit != c.ID {
+				t.Errorf("version %d: got commit %s, want %s", i+1, history[i].Commit, c.ID)
+			}
+			messages = append(messages, c.Message)
+			id = c.Parent
+		}
+		if want := []string{"delete a", "change a", "add a"}; !slices.Equal(messages, want) {
+			t.Errorf("got commits %q, want %q", messages, want)
+		}
+		if err := r.PrintCommits(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.PrintHistory(name); err != nil {
+			t.Fatal(err)
+		}
+
+		for version, content := range map[int]string{1: "first", 2: "second", 0: "second"} {
+			if err := r.Restore(name, version); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, "a.txt"); got != content {
+				t.Errorf("version %d: got %q, want %q", version, got, content)
+			}
+		}
+		if err := r.Restore(name, 3); err == nil || !strings.Contains(err.Error(), "deletion") {
+			t.Errorf("got %v, want restoring the deletion to fail", err)
+		}
+		if err := r.Restore(name, 4); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("got %v, want restoring a missing version to fail", err)
+		}
+	})
+}
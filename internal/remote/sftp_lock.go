@@ -0,0 +1,235 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/ignore"
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/user"
+)
+
+const DirLocks = "locks"
+
+type Lock struct {
+	Owner string    `json:"owner"`
+	Host  string    `json:"host"`
+	Time  time.Time `json:"time"`
+}
+
+func (l Lock) ToString() string {
+	return fmt.Sprintf("locked by %s@%s since %s", l.Owner, l.Host, l.Time.Format(time.UnixDate))
+}
+
+// isMine reports if the lock was taken by this user on this host, the same user name on another machine is someone else.
+func (l Lock) isMine() bool {
+	return l.Owner == user.Name() && l.Host == user.Host()
+}
+
+func (r *Remote) Lock(name paths.Path) error {
+	unixName := name.ToUnix()
+	remoteLockName, err := r.remotePath(DirLocks, unixName, "")
+	if err != nil {
+		return err
+	}
+	l := Lock{
+		Owner: user.Name(),
+		Host:  user.Host(),
+		Time:  time.Now(),
+	}
+
+	// exclusive create, only one client can win the lock
+	if err := r.createRemoteFile(remoteLockName, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(&l)
+	}); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return errors.Join(fmt.Errorf("failed to create lock file %s on remote", remoteLockName), err)
+		}
+		l, getErr := r.getLock(unixName)
+		if getErr != nil || l == nil {
+			return errors.Join(fmt.Errorf("failed to create lock file %s on remote", remoteLockName), err, getErr)
+		}
+		if l.isMine() {
+			fmt.Printf("%s is already locked by you\n", unixName)
+			return nil
+		}
+		return fmt.Errorf("%s is %s", unixName, l.ToString())
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("locked %s\n", unixName)
+	}
+
+	return nil
+}
+
+func (r *Remote) Unlock(name paths.Path) error {
+	unixName := name.ToUnix()
+	remoteLockName, err := r.remotePath(DirLocks, unixName, "")
+	if err != nil {
+		return err
+	}
+
+	l, err := r.getLock(unixName)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return fmt.Errorf("%s is not locked", unixName)
+	}
+	if !l.isMine() && !options.FlagForce {
+		return fmt.Errorf("%s is %s, use --force to unlock it anyway", unixName, l.ToString())
+	}
+
+	if err := r.Backend.Remove(remoteLockName); err != nil {
+		return errors.Join(fmt.Errorf("failed to remove file %s", remoteLockName), err)
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("unlocked %s\n", unixName)
+	}
+
+	return nil
+}
+
+func (r *Remote) PrintLocks() error {
+	pushLock, err := r.getPushLock()
+	if err != nil {
+		return err
+	}
+	if pushLock != nil {
+		now, err := r.remoteNow()
+		if err != nil {
+			return errors.Join(errors.New("failed to get time of remote"), err)
+		}
+		if pushLock.IsStale(now) {
+			fmt.Printf("remote is %s (stale)\n", pushLock.ToString())
+		} else {
+			fmt.Printf("remote is %s\n", pushLock.ToString())
+		}
+	}
+
+	locks, err := r.getLocks()
+	if err != nil {
+		return err
+	}
+
+	if len(locks) == 0 {
+		fmt.Println("no locks on remote")
+		return nil
+	}
+
+	names := make([]paths.Unix, 0, len(locks))
+	for name := range locks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		fmt.Printf("%s %s\n", name, locks[name].ToString())
+	}
+
+	return nil
+}
+
+// getLock returns the lock of a file or nil if it is not locked.
+func (r *Remote) getLock(name paths.Unix) (*Lock, error) {
+	remoteLockName, err := r.remotePath(DirLocks, name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := r.openRemoteFile(remoteLockName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteLockName), err)
+	}
+	defer f.Close()
+
+	l := &Lock{}
+	if err := json.NewDecoder(f).Decode(l); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", remoteLockName), err)
+	}
+
+	return l, nil
+}
+
+func (r *Remote) getLocks() (map[paths.Unix]Lock, error) {
+	locks := make(map[paths.Unix]Lock)
+
+	remoteWalkRoot := path.Join(r.Config.Remote.Path, DirLocks)
+	remoteWalker := r.Backend.Walk(remoteWalkRoot)
+	for remoteWalker.Step() {
+		if err := remoteWalker.Err(); err != nil {
+			if os.IsNotExist(err) && remoteWalker.Path() == remoteWalkRoot {
+				// nothing locked yet
+				break
+			}
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		if remoteWalker.Stat().IsDir() {
+			continue
+		}
+
+		unixPath, err := paths.Unix(remoteWalker.Path()).Rel(remoteWalkRoot)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		if unixPath, err = r.decodePath(unixPath); err != nil {
+			return nil, err
+		}
+
+		l, err := r.getLock(unixPath)
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			locks[unixPath] = *l
+		}
+	}
+
+	return locks, nil
+}
+
+// checkLocks makes sure no file is locked by someone else and lockable files are locked by the pusher.
+func (r *Remote) checkLocks(files []*commitFile) error {
+	if options.FlagForce {
+		return nil
+	}
+
+	locks, err := r.getLocks()
+	if err != nil {
+		return errors.Join(errors.New("failed to get locks"), err)
+	}
+
+	lockableMatcher := ignore.GetLockableMatcher(r.Config)
+
+	var problems []string
+	for _, cf := range files {
+		unixName := cf.Path.ToUnix()
+		if l, ok := locks[unixName]; ok {
+			if !l.isMine() {
+				problems = append(problems, fmt.Sprintf("%s is %s", unixName, l.ToString()))
+			}
+		} else if lockableMatcher.Match(unixName.ToGit(), false) {
+			problems = append(problems, fmt.Sprintf("%s is lockable and must be locked before pushing", unixName))
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("refusing to push, use --force to push anyway\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/user"
+)
+
+func TestLock(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Lock(paths.Unix("a.txt")); err != nil {
+			t.Fatal(err)
+		}
+		// locking it again as the same user is fine
+		if err := r.Lock(paths.Unix("a.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if locks, err := r.getLocks(); err != nil {
+			t.Fatal(err)
+		} else if _, ok := locks["a.txt"]; !ok || len(locks) != 1 {
+			t.Fatalf("remote has locks %v, want a.txt", locks)
+		}
+
+		if err := r.Unlock(paths.Unix("a.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if locks, err := r.getLocks(); err != nil {
+			t.Fatal(err)
+		} else if len(locks) != 0 {
+			t.Fatalf("remote has locks %v after unlocking", locks)
+		}
+		if err := r.Unlock(paths.Unix("a.txt")); err == nil {
+			t.Fatal("unlocked a file that is not locked")
+		}
+	})
+}
+
+func TestLockOtherHost(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the same user name on another machine
+		l := Lock{Owner: user.Name(), Host: user.Host() + "-other", Time: time.Now()}
+		remoteLockName, err := r.remotePath(DirLocks, paths.Unix("a.txt"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.createRemoteFile(remoteLockName, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&l)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Lock(paths.Unix("a.txt")); err == nil {
+			t.Fatal("locked a file locked on another host")
+		}
+		if err := r.Unlock(paths.Unix("a.txt")); err == nil {
+			t.Fatal("unlocked a file locked on another host")
+		}
+		writeFile(t, "a.txt", "changed")
+		withMessage(t, "change")
+		if err := r.CommitPaths(nil); err == nil || !strings.Contains(err.Error(), "a.txt is locked by") {
+			t.Fatalf("got %v, want the push to be refused", err)
+		}
+	})
+}
+
+func TestPushLock(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		r := connectTest(t, p)
+		other := connectTest(t, p)
+
+		unlock, err := r.lockPush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if otherUnlock, err := other.lockPush(); err == nil {
+			otherUnlock()
+			unlock()
+			t.Fatal("two clients hold the push lock")
+		}
+
+		unlock()
+		otherUnlock, err := other.lockPush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherUnlock()
+	})
+}
+
+func TestPushLockClockSkew(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		r := connectTest(t, p)
+		other := connectTest(t, p)
+
+		// the clock of the holder is an hour behind, the lock was still taken just now
+		l := PushLock{ID: "skewed", Holder: "someone", Host: "elsewhere", PID: 1, Time: time.Now().Add(-time.Hour)}
+		if err := other.createRemoteFile(other.pushLockName(), func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&l)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if unlock, err := r.lockPush(); err == nil {
+			unlock()
+			t.Fatal("took a held push lock")
+		} else if !strings.Contains(err.Error(), "try again later") {
+			t.Fatalf("got %v, want the lock to be held", err)
+		}
+		if err := r.BreakStalePushLock(); err == nil {
+			t.Fatal("broke a push lock that is not stale")
+		}
+	})
+}
+
+func TestPushLockLost(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		r := connectTest(t, p)
+		other := connectTest(t, p)
+
+		unlock, err := r.lockPush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.checkPushLock(); err != nil {
+			t.Fatal(err)
+		}
+
+		// someone else breaks the lock and takes it
+		force := options.FlagForce
+		options.FlagForce = true
+		err = other.BreakStalePushLock()
+		options.FlagForce = force
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherUnlock, err := other.lockPush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.checkPushLock(); !errors.Is(err, errPushLockLost) {
+			t.Fatalf("got %v, want the lock to be lost", err)
+		}
+		withMessage(t, "")
+		if err := r.commit(nil); !errors.Is(err, errPushLockLost) {
+			t.Fatalf("committed without the push lock: %v", err)
+		}
+
+		// releasing the lost lock must not release the lock of the new holder
+		unlock()
+		if held, err := r.getPushLock(); err != nil {
+			t.Fatal(err)
+		} else if held == nil || held.ID != other.pushLock.id {
+			t.Fatalf("push lock is %v, want the lock of the new holder", held)
+		}
+		otherUnlock()
+	})
+}
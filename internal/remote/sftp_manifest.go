@@ -0,0 +1,156 @@
+package remote
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+)
+
+const FileManifest = "manifest.json.gz"
+
+// Manifest is a snapshot of all metas at a commit, so the remote state can be fetched in one download.
+type Manifest struct {
+	Head  string              `json:"head"`
+	Files map[paths.Unix]Meta `json:"files"`
+}
+
+// getRemoteMetas returns the metas of all files on the remote.
+// The manifest is only trusted if it belongs to the current head, otherwise the meta directory is walked.
+func (r *Remote) getRemoteMetas() (map[paths.Unix]Meta, error) {
+	head, err := r.Head()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to get remote head"), err)
+	}
+
+	m, err := r.getManifest()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to get remote manifest"), err)
+	}
+	if m != nil && m.Head == head {
+		return m.Files, nil
+	}
+
+	if options.FlagVerbose {
+		fmt.Println("remote manifest is outdated, reading all metas")
+	}
+
+	return r.walkRemoteMetas()
+}
+
+func (r *Remote) walkRemoteMetas() (map[paths.Unix]Meta, error) {
+	metas := make(map[paths.Unix]Meta)
+
+	remoteWalkRoot := path.Join(r.Config.Remote.Path, DirMeta)
+	remoteWalker := r.Backend.Walk(remoteWalkRoot)
+	for remoteWalker.Step() {
+		if err := remoteWalker.Err(); err != nil {
+			if os.IsNotExist(err) && remoteWalker.Path() == remoteWalkRoot {
+				// nothing pushed yet
+				break
+			}
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		if remoteWalker.Stat().IsDir() {
+			continue
+		}
+
+		unixPath, err := paths.Unix(remoteWalker.Path()).Rel(remoteWalkRoot)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		if unixPath, err = r.decodePath(unixPath); err != nil {
+			return nil, err
+		}
+
+		rm, err := r.getRemoteMeta(unixPath)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to get remote meta from %s", unixPath), err)
+		}
+		metas[unixPath] = rm
+	}
+
+	return metas, nil
+}
+
+// getManifest returns nil if the remote has no manifest yet.
+func (r *Remote) getManifest() (*Manifest, error) {
+	remoteName := path.Join(r.Config.Remote.Path, FileManifest)
+
+	f, err := r.openRemoteFile(remoteName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteName), err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open gzip reader for %s on remote", remoteName), err)
+	}
+	defer gr.Close()
+
+	m := &Manifest{}
+	if err := json.NewDecoder(gr).Decode(m); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", remoteName), err)
+	}
+
+	return m, nil
+}
+
+// updateManifest applies the commit to the manifest of its parent.
+// If the manifest does not belong to the parent, it is rebuilt from the meta directory.
+func (r *Remote) updateManifest(c Commit, metas map[paths.Unix]Meta) error {
+	m, err := r.getManifest()
+	if err != nil {
+		return err
+	}
+
+	if m != nil && m.Head == c.ID {
+		// updated by an earlier attempt
+		return nil
+	}
+
+	if m != nil && m.Head == c.Parent {
+		for name, meta := range metas {
+			if meta.Deleted {
+				delete(m.Files, name)
+			} else {
+				m.Files[name] = meta
+			}
+		}
+	} else {
+		files, err := r.walkRemoteMetas()
+		if err != nil {
+			return err
+		}
+		m = &Manifest{Files: files}
+	}
+	m.Head = c.ID
+
+	return r.pushManifest(m)
+}
+
+func (r *Remote) pushManifest(m *Manifest) error {
+	remoteName := path.Join(r.Config.Remote.Path, FileManifest)
+
+	if err := r.writeRemoteFile(remoteName, func(w io.Writer) error {
+		gw := gzip.NewWriter(w)
+		if err := json.NewEncoder(gw).Encode(m); err != nil {
+			return err
+		}
+		return gw.Close()
+	}); err != nil {
+		return errors.Join(fmt.Errorf("failed to write manifest to file %s on remote", remoteName), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// Migrate upgrades the remote to the current layout version.
+func (r *Remote) Migrate() error {
+	if r.Layout == project.Version {
+		fmt.Printf("remote already uses layout version %d\n", r.Layout)
+		return nil
+	}
+
+	unlock, err := r.lockPush()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// commits exist since layout 4, interrupted ones of older layouts have to be finished by the client that created them
+	if r.Layout >= 4 {
+		if err := r.Recover(); err != nil {
+			return errors.Join(errors.New("failed to recover interrupted commits"), err)
+		}
+	}
+
+	if fis, err := r.Backend.ReadDir(path.Join(r.Config.Remote.Path, DirStaging)); err == nil && len(fis) != 0 {
+		return errors.New("remote has interrupted commits, finish them with the zet version that created them first")
+	}
+
+	if r.Layout < 4 {
+		if err := r.migrateObjects(); err != nil {
+			return errors.Join(errors.New("failed to migrate blobs to content addressed objects"), err)
+		}
+	}
+
+	if err := r.pushVersion(); err != nil {
+		return errors.Join(errors.New("failed to push version"), err)
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("migrated remote from layout version %d to %d\n", r.Layout, project.Version)
+	}
+	r.Layout = project.Version
+
+	return nil
+}
+
+// migrateObjects moves path based blobs from content and history into the objects directory.
+func (r *Remote) migrateObjects() error {
+	names, err := r.listRemoteNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if options.FlagVerbose {
+			fmt.Printf("migrating %s\n", name)
+		}
+
+		history, err := r.History(name)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to get history of %s", name), err)
+		}
+
+		for i, m := range history {
+			if m.Deleted {
+				continue
+			}
+
+			blobName := r.blobName(name, m, i == len(history)-1)
+			objectName := r.objectName(m.Hash)
+
+			if _, err := r.Backend.Stat(objectName); err == nil {
+				// identical content was already migrated
+				if err := r.Backend.Remove(blobName); err != nil && !os.IsNotExist(err) {
+					return errors.Join(fmt.Errorf("failed to remove file %s", blobName), err)
+				}
+				continue
+			} else if !os.IsNotExist(err) {
+				return errors.Join(fmt.Errorf("failed to stat file %s on remote", objectName), err)
+			}
+
+			if _, err := r.Backend.Stat(blobName); err != nil {
+				if os.IsNotExist(err) {
+					fmt.Fprintf(os.Stderr, "version %d of %s has no content on the remote, skipping it\n", m.Version, name)
+					continue
+				}
+				return errors.Join(fmt.Errorf("failed to stat file %s on remote", blobName), err)
+			}
+
+			objectDir := path.Dir(objectName)
+			if err := r.Backend.MkdirAll(objectDir); err != nil && !os.IsExist(err) {
+				return errors.Join(fmt.Errorf("failed to make directory %s on remote", objectDir), err)
+			}
+			if err := r.Backend.Rename(blobName, objectName); err != nil {
+				return errors.Join(fmt.Errorf("failed to move %s to %s on remote", blobName, objectName), err)
+			}
+		}
+
+		// files pushed by layout version 1 have no log yet
+		if err := r.pushHistory(name, history); err != nil {
+			return errors.Join(fmt.Errorf("failed to push history of %s", name), err)
+		}
+	}
+
+	contentRoot := path.Join(r.Config.Remote.Path, DirContent)
+	if err := r.Backend.RemoveAll(contentRoot); err != nil && !os.IsNotExist(err) {
+		return errors.Join(fmt.Errorf("failed to remove directory %s", contentRoot), err)
+	}
+
+	return nil
+}
+
+// listRemoteNames returns every file that has a meta or a history on the remote, including deleted ones.
+func (r *Remote) listRemoteNames() ([]paths.Unix, error) {
+	var names []paths.Unix
+	seen := make(map[paths.Unix]struct{})
+
+	metaRoot := path.Join(r.Config.Remote.Path, DirMeta)
+	historyRoot := path.Join(r.Config.Remote.Path, DirHistory)
+
+	for _, root := range []string{metaRoot, historyRoot} {
+		walker := r.Backend.Walk(root)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				if os.IsNotExist(err) && walker.Path() == root {
+					break
+				}
+				return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+			}
+			if walker.Stat().IsDir() {
+				continue
+			}
+
+			unixPath, err := paths.Unix(walker.Path()).Rel(root)
+			if err != nil {
+				return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+			}
+
+			if root == historyRoot {
+				// only logs identify files, older layouts store blobs next to them
+				var ok bool
+				if unixPath, ok = unixPath.CutSuffix(unixPath, ".log"); !ok {
+					continue
+				}
+			}
+			if unixPath, err = r.decodePath(unixPath); err != nil {
+				return nil, err
+			}
+
+			if _, ok := seen[unixPath]; !ok {
+				seen[unixPath] = struct{}{}
+				names = append(names, unixPath)
+			}
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+// setLayout makes the remote of r claim an older layout version.
+func setLayout(t *testing.T, r *Remote, version int) {
+	t.Helper()
+
+	if err := r.writeRemoteFile(path.Join(r.Config.Remote.Path, FileVersion), func(w io.Writer) error {
+		_, err := io.WriteString(w, strconv.Itoa(version))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		first := newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+		writeFile(t, "dir/b.txt", "b")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+		setLayout(t, r, project.Version-1)
+
+		old := connectTest(t, p)
+		if old.Layout != project.Version-1 {
+			t.Fatalf("got layout %d, want %d", old.Layout, project.Version-1)
+		}
+		writeFile(t, "a.txt", "changed")
+		withMessage(t, "second")
+		if err := old.CommitPaths(nil); err == nil || !strings.Contains(err.Error(), "migrate") {
+			t.Fatalf("got %v, want commits to the old layout to be refused", err)
+		}
+
+		if err := old.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		if old.Layout != project.Version {
+			t.Fatalf("got layout %d after migrating, want %d", old.Layout, project.Version)
+		}
+		if err := old.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		migrated := connectTest(t, p)
+		if migrated.Layout != project.Version {
+			t.Fatalf("remote reports layout %d after migrating, want %d", migrated.Layout, project.Version)
+		}
+		if err := migrated.Verify(false); err != nil {
+			t.Fatal(err)
+		}
+
+		newWorkTree(t)
+		if err := migrated.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"a.txt": "changed", "dir/b.txt": "b"} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+
+		t.Chdir(first)
+		assertStatus(t, commitableStatus(t, migrated), nil)
+	})
+}
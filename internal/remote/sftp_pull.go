@@ -0,0 +1,235 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/charmbracelet/huh"
+)
+
+func (r *Remote) PullInteractive() error {
+	pullables, err := r.getPullable()
+	if err != nil {
+		return errors.Join(errors.New("failed to get remote changes"), err)
+	}
+
+	if len(pullables) == 0 {
+		fmt.Println("already up to date")
+		return nil
+	}
+
+	opts := make([]huh.Option[*commitFile], len(pullables))
+
+	for i, cf := range pullables {
+		switch cf.Status {
+		case commitFileStatusDelete:
+			opts[i] = huh.Option[*commitFile]{
+				Key:   fmt.Sprintf("%s %s deleted at %s by %s", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor),
+				Value: &cf,
+			}
+		case commitFileStatusConflict:
+			opts[i] = huh.Option[*commitFile]{
+				Key:   fmt.Sprintf("%s %s changed locally and at %s by %s", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor),
+				Value: &cf,
+			}
+		default:
+			opts[i] = huh.Option[*commitFile]{
+				Key:   fmt.Sprintf("%s %s changed at %s by %s", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor),
+				Value: &cf,
+			}
+		}
+	}
+
+	var selectedPullables []*commitFile
+
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewMultiSelect[*commitFile]().
+			Title("Diff from current remote").
+			Options(opts...).
+			Value(&selectedPullables),
+	)).Run(); err != nil {
+		return err
+	}
+
+	return r.pull(selectedPullables)
+}
+
+// pull applies remote changes to the working tree.
+// Local changes are never overwritten without --force.
+func (r *Remote) pull(files []*commitFile) error {
+	if !options.FlagForce {
+		var problems []string
+		for _, cf := range files {
+			if cf.Status == commitFileStatusConflict {
+				problems = append(problems, fmt.Sprintf("%s was changed locally", cf.Path.ToUnix()))
+			}
+		}
+		if len(problems) != 0 {
+			return fmt.Errorf("refusing to overwrite local changes, push first or use --force to pull anyway\n%s", strings.Join(problems, "\n"))
+		}
+	}
+
+	// hashes of the files after pulling, nil for deleted files
+	hashes := make([][]byte, len(files))
+	done := make([]bool, len(files))
+
+	pullErr := util.Parallel(len(files), options.FlagJobs, func(i int) error {
+		unixName := files[i].Path.ToUnix()
+
+		rm, err := r.getRemoteMeta(unixName)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.Join(fmt.Errorf("failed to get remote meta from %s", unixName), err)
+		}
+
+		if err == nil {
+			if err := r.pullFile(unixName, rm); err != nil {
+				return errors.Join(fmt.Errorf("failed to pull %s", unixName), err)
+			}
+			hashes[i] = rm.Hash
+		} else {
+			sysPath := unixName.ToSystem()
+			if err := removeLocalFile(sysPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return errors.Join(fmt.Errorf("failed to delete %s", sysPath), err)
+			}
+		}
+		done[i] = true
+
+		return nil
+	})
+
+	// record the files that were pulled, even if others failed
+	for i, cf := range files {
+		if !done[i] {
+			continue
+		}
+		if err := r.setBase(cf.Path.ToUnix(), hashes[i]); err != nil {
+			return errors.Join(pullErr, err)
+		}
+	}
+
+	if err := r.saveBase(); err != nil {
+		return errors.Join(pullErr, err)
+	}
+
+	return pullErr
+}
+
+func (r *Remote) Clone() error {
+	if options.FlagVerbose {
+		fmt.Println("cloning remote")
+	}
+
+	pullables, err := r.getPullable()
+	if err != nil {
+		return errors.Join(errors.New("failed to get remote files"), err)
+	}
+
+	// files that already exist locally with other contents are conflicts,
+	// pull overwrites them with --force and refuses to clone otherwise
+	files := make([]*commitFile, 0, len(pullables))
+	for _, cf := range pullables {
+		if cf.Status == commitFileStatusCreate || cf.Status == commitFileStatusConflict {
+			files = append(files, &cf)
+		}
+	}
+
+	return r.pull(files)
+}
+
+func (r *Remote) PullIgnore() (string, error) {
+	remoteName := path.Join(r.Config.Remote.Path, FileIgnore)
+
+	rf, err := r.openRemoteFile(remoteName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.Join(fmt.Errorf("failed to open file %s on remote", remoteName), err)
+	}
+	defer rf.Close()
+
+	b, err := io.ReadAll(rf)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to read ignore from remote"), err)
+	}
+
+	return string(b), nil
+}
+
+func (r *Remote) getPullable() ([]commitFile, error) {
+	diffs, err := r.diff()
+	if err != nil {
+		return nil, err
+	}
+
+	pullables := make([]commitFile, 0, len(diffs))
+	for _, fd := range diffs {
+		if fd.RemoteStatus == nil {
+			continue
+		}
+
+		cf := commitFile{
+			Path:   fd.Path,
+			Status: *fd.RemoteStatus,
+		}
+		if fd.Remote != nil {
+			cf.LastEditor = fd.Remote.LastEditor
+			cf.LastEdit = fd.Remote.LastEdit
+		} else if history, err := r.History(fd.Path); err == nil && len(history) != 0 {
+			// deleted files only have their deletion left in the history
+			cf.LastEditor = history[len(history)-1].LastEditor
+			cf.LastEdit = history[len(history)-1].LastEdit
+		}
+		if fd.IsConflict() {
+			cf.Status = commitFileStatusConflict
+		}
+
+		pullables = append(pullables, cf)
+	}
+
+	return pullables, nil
+}
+
+func (r *Remote) pullFile(unixName paths.Unix, rm Meta) error {
+	sysPath := unixName.ToSystem()
+	remoteName := r.blobName(unixName, rm, true)
+
+	if err := r.downloadFile(remoteName, sysPath, rm); err != nil {
+		return err
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("pulled %s\n", unixName)
+	}
+
+	return nil
+}
+
+func removeLocalFile(sysPath paths.System) error {
+	if err := os.Remove(string(sysPath)); err != nil {
+		return errors.Join(fmt.Errorf("failed to remove file %s", sysPath), err)
+	}
+
+	// clean up directories that became empty, os.Remove refuses to remove non-empty ones
+	for dir := filepath.Dir(string(sysPath)); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("removed %s\n", sysPath)
+	}
+
+	return nil
+}
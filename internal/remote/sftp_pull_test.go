@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/state"
+)
+
+// pullableStatus maps the unix paths of the pullable files to their status.
+func pullableStatus(t *testing.T, r *Remote) map[paths.Unix]commitFileStatus {
+	t.Helper()
+
+	pullables, err := r.getPullable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := make(map[paths.Unix]commitFileStatus, len(pullables))
+	for _, cf := range pullables {
+		status[cf.Path.ToUnix()] = cf.Status
+	}
+	return status
+}
+
+// pullAll pulls every remote change, like selecting all of them in the pull form.
+func pullAll(t *testing.T, r *Remote) {
+	t.Helper()
+
+	pullables, err := r.getPullable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make([]*commitFile, len(pullables))
+	for i := range pullables {
+		files[i] = &pullables[i]
+	}
+	if err := r.pull(files); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPull(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		first := newWorkTree(t)
+		writeFile(t, "changed.txt", "old")
+		writeFile(t, "deleted.txt", "deleted")
+		writeFile(t, "unchanged.txt", "unchanged")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		second := newWorkTree(t)
+		other := connectTest(t, p)
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Chdir(first)
+		writeFile(t, "changed.txt", "new")
+		if err := os.Remove("deleted.txt"); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "dir/added.txt", "added")
+		withMessage(t, "second")
+		if err := r.CommitPaths(nil); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Chdir(second)
+		assertStatus(t, pullableStatus(t, other), map[paths.Unix]commitFileStatus{
+			"changed.txt":   commitFileStatusChange,
+			"deleted.txt":   commitFileStatusDelete,
+			"dir/added.txt": commitFileStatusCreate,
+		})
+
+		pullAll(t, other)
+
+		for name, content := range map[string]string{"changed.txt": "new", "dir/added.txt": "added", "unchanged.txt": "unchanged"} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+		if _, err := os.Stat("deleted.txt"); !os.IsNotExist(err) {
+			t.Errorf("deleted.txt was not deleted: %v", err)
+		}
+		if entries, err := os.ReadDir(filepath.Join(state.Dir, state.DirTransfers)); err == nil && len(entries) != 0 {
+			t.Errorf("temporary files were left behind: %v", entries)
+		}
+		assertStatus(t, pullableStatus(t, other), nil)
+		assertStatus(t, commitableStatus(t, other), nil)
+	})
+}
+
+func TestCloneForce(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "differs.txt", "remote")
+		writeFile(t, "same.txt", "same")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// clone into a directory that already has some of the files
+		newWorkTree(t)
+		writeFile(t, "differs.txt", "local")
+		writeFile(t, "same.txt", "same")
+		writeFile(t, "extra.txt", "extra")
+		other := connectTest(t, p)
+
+		err := other.Clone()
+		if err == nil || !strings.Contains(err.Error(), "differs.txt was changed locally") {
+			t.Fatalf("clone without --force: got %v, want an error naming differs.txt", err)
+		}
+		if got := readFile(t, "differs.txt"); got != "local" {
+			t.Errorf("clone without --force overwrote differs.txt with %q", got)
+		}
+
+		force := options.FlagForce
+		options.FlagForce = true
+		err = other.Clone()
+		options.FlagForce = force
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, content := range map[string]string{"differs.txt": "remote", "same.txt": "same", "extra.txt": "extra"} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+		assertStatus(t, pullableStatus(t, other), nil)
+		assertStatus(t, commitableStatus(t, other), map[paths.Unix]commitFileStatus{
+			"extra.txt": commitFileStatusCreate,
+		})
+	})
+}
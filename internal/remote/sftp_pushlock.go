@@ -0,0 +1,285 @@
+package remote
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/user"
+)
+
+// FilePushLock is held on the remote by the client that is currently changing it
+const FilePushLock = "push.lock"
+
+const (
+	// pushLockTTL is how long a push lock stays valid without being refreshed, in the time of the remote
+	pushLockTTL = 5 * time.Minute
+	// pushLockRefresh is how often the holder of a push lock shows that it is still alive
+	pushLockRefresh = time.Minute
+	// pushLockPoll is how often a waiting client checks if the push lock was released
+	pushLockPoll = 2 * time.Second
+)
+
+// errPushLockLost means the push lock was broken while it was held, so someone else may change the remote.
+var errPushLockLost = errors.New("lost push lock, someone else may change the remote concurrently")
+
+type PushLock struct {
+	// ID is unique to every acquisition of the lock
+	ID     string    `json:"id"`
+	Holder string    `json:"holder"`
+	PID    int       `json:"pid"`
+	Host   string    `json:"host"`
+	Time   time.Time `json:"time"`
+
+	// alive is the remote time the holder last refreshed the lock at
+	alive time.Time
+}
+
+// heldPushLock is the push lock while this client holds it.
+type heldPushLock struct {
+	id string
+	// ctx is canceled with errPushLockLost once the lock is lost
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func (l PushLock) ToString() string {
+	return fmt.Sprintf("locked by %s@%s (pid %d) since %s, last refreshed at %s", l.Holder, l.Host, l.PID, l.Time.Format(time.UnixDate), l.alive.Local().Format(time.UnixDate))
+}
+
+// IsStale reports if the holder stopped refreshing the lock, most likely because it crashed.
+// now is the current time of the remote, the clocks of the clients may differ from it and from each other.
+func (l PushLock) IsStale(now time.Time) bool {
+	return now.Sub(l.alive) > pushLockTTL
+}
+
+func (r *Remote) pushLockName() string {
+	return path.Join(r.Config.Remote.Path, FilePushLock)
+}
+
+// pushLockAliveName is the file the holder of the lock with the given id touches to show that it is still alive.
+// The lock file itself is never rewritten, so a holder can't overwrite a lock that was broken and taken by someone else.
+func (r *Remote) pushLockAliveName(id string) string {
+	return path.Join(r.Config.Remote.Path, DirTemp, "push-"+id+".alive")
+}
+
+// remoteNow returns the current time of the remote, as the modification time of a new file.
+func (r *Remote) remoteNow() (time.Time, error) {
+	tempName, err := r.writeTemp(func(w io.Writer) error { return nil })
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer r.Backend.Remove(tempName)
+
+	fi, err := r.Backend.Stat(tempName)
+	if err != nil {
+		return time.Time{}, errors.Join(fmt.Errorf("failed to stat file %s on remote", tempName), err)
+	}
+	return fi.ModTime(), nil
+}
+
+// lockPush acquires the remote wide push lock, call the returned function to release it.
+// If someone else holds the lock, it waits up to options.FlagWait for it to be released.
+func (r *Remote) lockPush() (func(), error) {
+	remoteLockName := r.pushLockName()
+	deadline := time.Now().Add(options.FlagWait)
+	waiting := false
+
+	for {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+		l := PushLock{
+			ID:     hex.EncodeToString(id),
+			Holder: user.Name(),
+			PID:    os.Getpid(),
+			Host:   user.Host(),
+			Time:   time.Now(),
+		}
+
+		// exclusive create, only one client can win the lock
+		err := r.createRemoteFile(remoteLockName, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&l)
+		})
+		if err == nil {
+			if options.FlagVerbose {
+				fmt.Println("acquired push lock")
+			}
+			return r.keepPushLock(l), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, errors.Join(fmt.Errorf("failed to create lock file %s on remote", remoteLockName), err)
+		}
+
+		held, getErr := r.getPushLock()
+		if getErr != nil {
+			return nil, errors.Join(fmt.Errorf("failed to create lock file %s on remote", remoteLockName), err, getErr)
+		}
+		if held == nil {
+			// released in the meantime
+			continue
+		}
+
+		now, err := r.remoteNow()
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to get time of remote"), err)
+		}
+		if held.IsStale(now) {
+			return nil, fmt.Errorf("remote is %s, the lock expired so its holder probably crashed, use `%s lock --break-stale` to remove it", held.ToString(), filepath.Base(os.Args[0]))
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("remote is %s, try again later or use --wait to wait for it", held.ToString())
+		}
+
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "waiting for push lock, remote is %s\n", held.ToString())
+			waiting = true
+		}
+		time.Sleep(pushLockPoll)
+	}
+}
+
+// keepPushLock refreshes the held lock l until the returned function releases it.
+// If the lock is lost, r.checkPushLock fails from then on.
+func (r *Remote) keepPushLock(l PushLock) func() {
+	remoteLockName := r.pushLockName()
+	aliveName := r.pushLockAliveName(l.ID)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	r.pushLock = &heldPushLock{id: l.ID, ctx: ctx, cancel: cancel}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(pushLockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if held, err := r.getPushLock(); err != nil || held == nil || held.ID != l.ID {
+					fmt.Fprintln(os.Stderr, errPushLockLost)
+					cancel(errPushLockLost)
+					return
+				}
+				if err := r.writeRemoteFile(aliveName, func(w io.Writer) error { return nil }); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to refresh push lock: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		r.pushLock = nil
+		cancel(nil)
+
+		_ = r.Backend.Remove(aliveName)
+		if held, err := r.getPushLock(); err != nil || held == nil || held.ID != l.ID {
+			return
+		}
+		if err := r.Backend.Remove(remoteLockName); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "failed to release push lock %s: %s\n", remoteLockName, err)
+			return
+		}
+
+		if options.FlagVerbose {
+			fmt.Println("released push lock")
+		}
+	}
+}
+
+// checkPushLock fails if this client does not hold the push lock (anymore).
+// Call it before changes become visible, so a push never continues after its lock was broken.
+func (r *Remote) checkPushLock() error {
+	if r.pushLock == nil {
+		return errors.New("push lock is not held")
+	}
+	if err := context.Cause(r.pushLock.ctx); err != nil {
+		return err
+	}
+
+	held, err := r.getPushLock()
+	if err != nil {
+		return err
+	}
+	if held == nil || held.ID != r.pushLock.id {
+		r.pushLock.cancel(errPushLockLost)
+		return errPushLockLost
+	}
+	return nil
+}
+
+// getPushLock returns the push lock or nil if the remote is not locked.
+func (r *Remote) getPushLock() (*PushLock, error) {
+	remoteLockName := r.pushLockName()
+
+	f, err := r.openRemoteFile(remoteLockName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Join(fmt.Errorf("failed to open remote file %s", remoteLockName), err)
+	}
+	defer f.Close()
+
+	l := &PushLock{}
+	if err := json.NewDecoder(f).Decode(l); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read remote file %s", remoteLockName), err)
+	}
+
+	// the lock was alive when it was created or last refreshed, in the time of the remote
+	if fi, err := r.Backend.Stat(remoteLockName); err == nil {
+		l.alive = fi.ModTime()
+	}
+	if fi, err := r.Backend.Stat(r.pushLockAliveName(l.ID)); err == nil && fi.ModTime().After(l.alive) {
+		l.alive = fi.ModTime()
+	}
+
+	return l, nil
+}
+
+// BreakStalePushLock removes a push lock whose holder stopped refreshing it.
+// With options.FlagForce it also removes locks that are still valid.
+func (r *Remote) BreakStalePushLock() error {
+	l, err := r.getPushLock()
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		fmt.Println("remote is not locked for pushing")
+		return nil
+	}
+	if !options.FlagForce {
+		now, err := r.remoteNow()
+		if err != nil {
+			return errors.Join(errors.New("failed to get time of remote"), err)
+		}
+		if !l.IsStale(now) {
+			return fmt.Errorf("remote is %s, the lock is not stale, use --force to break it anyway", l.ToString())
+		}
+	}
+
+	remoteLockName := r.pushLockName()
+	if err := r.Backend.Remove(remoteLockName); err != nil && !os.IsNotExist(err) {
+		return errors.Join(fmt.Errorf("failed to remove file %s", remoteLockName), err)
+	}
+	_ = r.Backend.Remove(r.pushLockAliveName(l.ID))
+
+	fmt.Printf("broke push lock of %s@%s (pid %d)\n", l.Holder, l.Host, l.PID)
+
+	return nil
+}
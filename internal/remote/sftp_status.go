@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/user"
+)
+
+type statusFile struct {
+	Path       string            `json:"path"`
+	Local      *commitFileStatus `json:"local,omitempty"`
+	Remote     *commitFileStatus `json:"remote,omitempty"`
+	Conflict   bool              `json:"conflict,omitempty"`
+	LastEditor string            `json:"last_editor,omitempty"`
+	LastEdit   *time.Time        `json:"last_edit,omitempty"`
+}
+
+func (r *Remote) Status() error {
+	diffs, err := r.diff()
+	if err != nil {
+		return errors.Join(errors.New("failed to get changes"), err)
+	}
+
+	statusFiles := make([]statusFile, len(diffs))
+	var pushes, pulls, conflicts []commitFile
+	for i, fd := range diffs {
+		sf := statusFile{
+			Path:     fd.Path.ToString(),
+			Local:    fd.LocalStatus,
+			Remote:   fd.RemoteStatus,
+			Conflict: fd.IsConflict(),
+		}
+		cf := commitFile{Path: fd.Path}
+		if fd.Remote != nil {
+			sf.LastEditor = fd.Remote.LastEditor
+			sf.LastEdit = &fd.Remote.LastEdit
+			cf.LastEditor = fd.Remote.LastEditor
+			cf.LastEdit = fd.Remote.LastEdit
+		}
+		statusFiles[i] = sf
+
+		switch {
+		case sf.Conflict:
+			cf.Status = commitFileStatusConflict
+			conflicts = append(conflicts, cf)
+		case fd.LocalStatus != nil:
+			// the change to push was made here, by this user
+			cf.Status = *fd.LocalStatus
+			cf.LastEditor = user.Name()
+			cf.LastEdit = time.Now()
+			if fi, err := os.Stat(fd.Path.ToSystem().ToString()); err == nil {
+				cf.LastEdit = fi.ModTime()
+			}
+			statusFiles[i].LastEditor = cf.LastEditor
+			statusFiles[i].LastEdit = &cf.LastEdit
+			pushes = append(pushes, cf)
+		default:
+			cf.Status = *fd.RemoteStatus
+			pulls = append(pulls, cf)
+		}
+	}
+
+	switch {
+	case options.FlagJson:
+		je := json.NewEncoder(os.Stdout)
+		je.SetIndent("", "  ")
+		if err := je.Encode(statusFiles); err != nil {
+			return errors.Join(errors.New("failed to encode status"), err)
+		}
+	case options.FlagPorcelain:
+		for _, sf := range statusFiles {
+			local, remote := byte(' '), byte(' ')
+			if sf.Local != nil {
+				local = sf.Local.ToPorcelain()
+			}
+			if sf.Remote != nil {
+				remote = sf.Remote.ToPorcelain()
+			}
+			fmt.Printf("%c%c %s\n", local, remote, sf.Path)
+		}
+	default:
+		printStatus("Changes to push", pushes)
+		printStatus("Changes to pull", pulls)
+		if len(conflicts) != 0 {
+			printStatus("Conflicts", conflicts)
+		}
+	}
+
+	return nil
+}
+
+func printStatus(title string, cfs []commitFile) {
+	if len(cfs) == 0 {
+		fmt.Printf("%s: none\n", title)
+		return
+	}
+
+	fmt.Printf("%s:\n", title)
+	for _, cf := range cfs {
+		if cf.LastEditor == "" {
+			fmt.Printf("  %s %s\n", cf.Status.ToString(), cf.Path.ToString())
+		} else {
+			fmt.Printf("  %s %s last changed at %s by %s\n", cf.Status.ToString(), cf.Path.ToString(), cf.LastEdit.Format(time.UnixDate), cf.LastEditor)
+		}
+	}
+}
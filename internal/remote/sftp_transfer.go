@@ -0,0 +1,483 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/compression"
+	"github.com/bloodmagesoftware/zet/internal/crypt"
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/state"
+)
+
+const (
+	// DirUploads holds uploads that are not verified yet, they are resumed after an interruption
+	DirUploads = "uploads"
+	// checkpointSize is how many bytes are uploaded between two saves of the upload progress
+	checkpointSize = 16 << 20
+)
+
+// errUploadMismatch means the partial upload on the remote was made from different bytes and can't be resumed.
+var errUploadMismatch = errors.New("partial upload does not match the local file")
+
+func (r *Remote) pushFile(pat paths.System) (CommitEntry, error) {
+	unixName := pat.ToUnix()
+	ce := CommitEntry{Path: unixName}
+
+	stat, err := pat.Stat()
+	if err != nil {
+		return ce, errors.Join(fmt.Errorf("failed to stat file %s", pat), err)
+	}
+	ce.LastEdit = stat.ModTime()
+
+	ce.Hash, err = pat.Hash()
+	if err != nil {
+		return ce, errors.Join(fmt.Errorf("failed to get hash from %s", pat), err)
+	}
+
+	objectName := r.objectName(ce.Hash)
+
+	// files with identical content wait for each other, so the content is only uploaded once
+	unlock := r.lockObject(ce.Hash)
+	defer unlock()
+
+	if _, err := r.Backend.Stat(objectName); err == nil {
+		// identical content is already on the remote
+		if options.FlagVerbose {
+			fmt.Printf("%s is already on remote\n", pat)
+		}
+		return ce, nil
+	} else if !os.IsNotExist(err) {
+		return ce, errors.Join(fmt.Errorf("failed to stat file %s on remote", objectName), err)
+	}
+
+	err = r.uploadObject(pat, ce.Hash, objectName)
+	if errors.Is(err, errUploadMismatch) {
+		// start over, the partial upload is useless
+		if err := state.RemoveUpload(ce.Hash); err != nil {
+			return ce, err
+		}
+		err = r.uploadObject(pat, ce.Hash, objectName)
+	}
+	if err != nil {
+		return ce, err
+	}
+
+	if options.FlagVerbose {
+		fmt.Printf("pushed %s\n", pat)
+	}
+
+	return ce, nil
+}
+
+// uploadObject compresses the local file into a temporary remote file and moves it to objectName once it is verified.
+// On backends that write in place, the progress is saved in the local state, so an interrupted upload continues where it stopped.
+func (r *Remote) uploadObject(pat paths.System, contentHash []byte, objectName string) error {
+	_, resumable := r.Backend.(inPlaceWriter)
+
+	var up *state.Upload
+	if resumable {
+		var err error
+		if up, err = state.LoadUpload(contentHash); err != nil {
+			return errors.Join(errors.New("failed to load upload progress"), err)
+		}
+	}
+	if up == nil {
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+		up = &state.Upload{Remote: path.Join(DirUploads, r.objectIDString(contentHash)+"."+hex.EncodeToString(suffix))}
+	}
+	if r.key != nil && len(up.Salt) == 0 {
+		// a partial upload without salt can't be recreated, start it over
+		up.Salt = crypt.NewBlobSalt()
+		up.Offset = 0
+		up.Sum = nil
+	}
+
+	remoteName := path.Join(r.Config.Remote.Path, up.Remote)
+	remoteDir := path.Dir(remoteName)
+
+	if up.Offset != 0 {
+		if stat, err := r.Backend.Stat(remoteName); err != nil || stat.Size() < up.Offset {
+			// the partial upload is gone
+			up.Offset = 0
+			up.Sum = nil
+		} else if options.FlagVerbose {
+			fmt.Printf("resuming upload of %s at byte %d\n", pat, up.Offset)
+		}
+	}
+
+	f, err := pat.Open()
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open local file %s", pat), err)
+	}
+	defer f.Close()
+
+	policy, err := r.Config.Compression.Matcher().Policy(pat).Resolve(f)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to read local file %s", pat), err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Join(fmt.Errorf("failed to seek local file %s", pat), err)
+	}
+
+	if err := r.Backend.MkdirAll(remoteDir); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s on remote", remoteDir), err)
+	}
+
+	rf, err := r.Backend.Create(remoteName, false)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file %s on remote", remoteName), err)
+	}
+	defer rf.Close()
+
+	// drop anything after the last confirmed offset
+	if err := rf.Truncate(up.Offset); err != nil {
+		return errors.Join(fmt.Errorf("failed to truncate file %s on remote", remoteName), err)
+	}
+	if _, err := rf.Seek(up.Offset, io.SeekStart); err != nil {
+		return errors.Join(fmt.Errorf("failed to seek file %s on remote", remoteName), err)
+	}
+
+	uw := &uploadWriter{
+		// large writes let the SFTP client send several packets concurrently
+		w:           bufio.NewWriterSize(rf, transferBufferSize),
+		sum:         sha256.New(),
+		progress:    up,
+		contentHash: contentHash,
+		skip:        up.Offset,
+		skipSum:     up.Sum,
+		checkpoints: resumable,
+	}
+
+	// compression and encryption with the saved salt are deterministic, so the bytes before the offset are recreated and skipped
+	var out io.Writer = uw
+	var ew io.WriteCloser
+	if r.key != nil {
+		if ew, err = r.key.NewBlobWriter(uw, r.objectID(contentHash), up.Salt); err != nil {
+			if errors.Is(err, errUploadMismatch) {
+				return err
+			}
+			return errors.Join(fmt.Errorf("failed to encrypt %s", remoteName), err)
+		}
+		defer ew.Close()
+		out = ew
+	}
+
+	cw, err := compression.NewWriter(out, policy)
+	if err != nil {
+		if errors.Is(err, errUploadMismatch) {
+			return err
+		}
+		return errors.Join(fmt.Errorf("failed to open %s writer for %s on remote", policy.ToString(), remoteName), err)
+	}
+	defer cw.Close()
+
+	h := sha256.New()
+
+	mw := io.MultiWriter(h, cw)
+
+	if _, err := io.Copy(mw, f); err != nil {
+		if errors.Is(err, errUploadMismatch) {
+			return err
+		}
+		return errors.Join(fmt.Errorf("failed to copy file %s to remote", pat), err)
+	}
+
+	// Close the compression writer explicitly to ensure all data is flushed
+	if err := cw.Close(); err != nil {
+		if errors.Is(err, errUploadMismatch) {
+			return err
+		}
+		return errors.Join(fmt.Errorf("failed to close %s writer for %s", policy.ToString(), remoteName), err)
+	}
+	if ew != nil {
+		if err := ew.Close(); err != nil {
+			if errors.Is(err, errUploadMismatch) {
+				return err
+			}
+			return errors.Join(fmt.Errorf("failed to encrypt %s", remoteName), err)
+		}
+	}
+	if uw.pos < uw.skip {
+		return errUploadMismatch
+	}
+	if err := uw.w.Flush(); err != nil {
+		return errors.Join(fmt.Errorf("failed to write file %s on remote", remoteName), err)
+	}
+	if err := rf.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to close file %s on remote", remoteName), err)
+	}
+
+	if !bytes.Equal(contentHash, h.Sum(nil)) {
+		_ = r.Backend.Remove(remoteName)
+		_ = state.RemoveUpload(contentHash)
+		return fmt.Errorf("file %s changed while pushing", pat)
+	}
+	if stat, err := r.Backend.Stat(remoteName); err != nil {
+		return errors.Join(fmt.Errorf("failed to stat file %s on remote", remoteName), err)
+	} else if stat.Size() != uw.pos {
+		_ = r.Backend.Remove(remoteName)
+		_ = state.RemoveUpload(contentHash)
+		return fmt.Errorf("file %s on remote has %d bytes instead of %d", remoteName, stat.Size(), uw.pos)
+	}
+
+	// the object is only trusted once the remote returned the same bytes, including those of earlier attempts
+	if sum, err := r.remoteSum(remoteName); err != nil {
+		return errors.Join(fmt.Errorf("failed to read back file %s on remote", remoteName), err)
+	} else if !bytes.Equal(sum, uw.sum.Sum(nil)) {
+		_ = r.Backend.Remove(remoteName)
+		_ = state.RemoveUpload(contentHash)
+		return fmt.Errorf("file %s on remote does not match the uploaded bytes", remoteName)
+	}
+
+	objectDir := path.Dir(objectName)
+	if err := r.Backend.MkdirAll(objectDir); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s on remote", objectDir), err)
+	}
+	if err := r.Backend.Rename(remoteName, objectName); err != nil {
+		// backends that rename by copying may have copied the object before failing to remove the upload
+		if stat, statErr := r.Backend.Stat(objectName); statErr != nil || stat.Size() != uw.pos {
+			return errors.Join(fmt.Errorf("failed to move %s to %s on remote", remoteName, objectName), err)
+		}
+		_ = r.Backend.Remove(remoteName)
+	}
+
+	return state.RemoveUpload(contentHash)
+}
+
+// remoteSum returns the SHA-256 of the remote file name.
+func (r *Remote) remoteSum(name string) ([]byte, error) {
+	f, err := r.Backend.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, bufio.NewReaderSize(f, transferBufferSize)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// uploadWriter skips the bytes that are already on the remote and saves the progress at every checkpoint.
+type uploadWriter struct {
+	w *bufio.Writer
+	// sum is the hash of all bytes written so far, including the skipped ones
+	sum            hash.Hash
+	pos            int64
+	skip           int64
+	skipSum        []byte
+	lastCheckpoint int64
+	progress       *state.Upload
+	contentHash    []byte
+	// checkpoints is false for backends that upload on close, their progress is never confirmed before the end
+	checkpoints bool
+}
+
+func (uw *uploadWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if uw.pos < uw.skip {
+		k := min(int64(len(p)), uw.skip-uw.pos)
+		uw.sum.Write(p[:k])
+		uw.pos += k
+		p = p[k:]
+
+		if uw.pos == uw.skip {
+			if !bytes.Equal(uw.sum.Sum(nil), uw.skipSum) {
+				return 0, errUploadMismatch
+			}
+			uw.lastCheckpoint = uw.pos
+		}
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if _, err := uw.w.Write(p); err != nil {
+		return 0, err
+	}
+	uw.sum.Write(p)
+	uw.pos += int64(len(p))
+
+	if uw.checkpoints && uw.pos-uw.lastCheckpoint >= checkpointSize {
+		// flushing waits for the remote to confirm the writes
+		if err := uw.w.Flush(); err != nil {
+			return 0, err
+		}
+		uw.progress.Offset = uw.pos
+		uw.progress.Sum = uw.sum.Sum(nil)
+		if err := uw.progress.Save(uw.contentHash); err != nil {
+			return 0, errors.Join(errors.New("failed to save upload progress"), err)
+		}
+		uw.lastCheckpoint = uw.pos
+	}
+
+	return n, nil
+}
+
+// downloadFile decompresses the remote blob remoteName into sysPath and verifies it against m.
+// The compressed blob is downloaded into the local state first, so an interrupted download continues where it stopped.
+func (r *Remote) downloadFile(remoteName string, sysPath paths.System, m Meta) error {
+	unlock := r.lockObject(m.Hash)
+	defer unlock()
+
+	partName, err := r.fetchBlob(remoteName, m.Hash)
+	if err != nil {
+		return err
+	}
+
+	pf, err := os.Open(partName)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file %s", partName), err)
+	}
+	defer pf.Close()
+
+	var blob io.Reader = bufio.NewReaderSize(pf, transferBufferSize)
+	if r.key != nil {
+		if blob, err = r.key.NewBlobReader(blob, r.objectID(m.Hash)); err != nil {
+			_ = os.Remove(partName)
+			return errors.Join(fmt.Errorf("failed to decrypt %s", partName), err)
+		}
+	}
+
+	cr, err := compression.NewReader(blob)
+	if err != nil {
+		_ = os.Remove(partName)
+		return errors.Join(fmt.Errorf("failed to open decompressing reader for %s", partName), err)
+	}
+	defer cr.Close()
+
+	localDir := filepath.Dir(string(sysPath))
+	if err := os.MkdirAll(localDir, 0755); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s", localDir), err)
+	}
+
+	// write into a temporary file next to the partial download first,
+	// so an interrupted download never leaves a truncated or stray file in the working tree
+	tmpDir := filepath.Dir(partName)
+	f, err := os.CreateTemp(tmpDir, filepath.Base(partName)+".*.tmp")
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to create temporary file in %s", tmpDir), err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := sha256.New()
+
+	mw := io.MultiWriter(h, f)
+
+	if _, err := io.Copy(mw, cr); err != nil {
+		_ = os.Remove(partName)
+		return errors.Join(fmt.Errorf("failed to decompress file %s from remote", remoteName), err)
+	}
+
+	// keep the permissions of the file that gets replaced
+	var mode fs.FileMode = 0644
+	if stat, err := sysPath.Stat(); err == nil {
+		mode = stat.Mode().Perm()
+	}
+	if err := f.Chmod(mode); err != nil {
+		return errors.Join(fmt.Errorf("failed to change mode of temporary file %s", f.Name()), err)
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to close temporary file %s", f.Name()), err)
+	}
+
+	if hashVal := h.Sum(nil); !bytes.Equal(hashVal, m.Hash) {
+		// don't resume from corrupted bytes
+		_ = os.Remove(partName)
+		return fmt.Errorf("hash mismatch for %s, remote file might be corrupted", remoteName)
+	}
+
+	if err := os.Rename(f.Name(), string(sysPath)); err != nil {
+		return errors.Join(fmt.Errorf("failed to move downloaded file to %s", sysPath), err)
+	}
+
+	// restore the modification time so tools relying on it don't treat the file as new
+	if err := os.Chtimes(string(sysPath), m.LastEdit, m.LastEdit); err != nil {
+		return errors.Join(fmt.Errorf("failed to set modification time of %s", sysPath), err)
+	}
+
+	_ = pf.Close()
+	if err := os.Remove(partName); err != nil {
+		return errors.Join(fmt.Errorf("failed to remove file %s", partName), err)
+	}
+
+	return nil
+}
+
+// fetchBlob downloads the remote blob into the local state and returns the local name.
+// A partial download of an earlier attempt is continued.
+func (r *Remote) fetchBlob(remoteName string, contentHash []byte) (string, error) {
+	partName, err := state.DownloadName(contentHash)
+	if err != nil {
+		return "", err
+	}
+
+	rf, err := r.Backend.Open(remoteName)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to open file %s on remote", remoteName), err)
+	}
+	defer rf.Close()
+
+	remoteStat, err := rf.Stat()
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to stat file %s on remote", remoteName), err)
+	}
+
+	pf, err := os.OpenFile(partName, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to open file %s", partName), err)
+	}
+	defer pf.Close()
+
+	partStat, err := pf.Stat()
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to stat file %s", partName), err)
+	}
+
+	offset := partStat.Size()
+	if offset > remoteStat.Size() {
+		offset = 0
+	}
+	if offset != 0 && options.FlagVerbose {
+		fmt.Printf("resuming download of %s at byte %d\n", remoteName, offset)
+	}
+
+	if err := pf.Truncate(offset); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to truncate file %s", partName), err)
+	}
+	if _, err := pf.Seek(offset, io.SeekStart); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to seek file %s", partName), err)
+	}
+	if _, err := rf.Seek(offset, io.SeekStart); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to seek file %s on remote", remoteName), err)
+	}
+
+	if _, err := io.Copy(pf, rf); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to copy file %s from remote", remoteName), err)
+	}
+
+	if err := pf.Close(); err != nil {
+		return "", errors.Join(fmt.Errorf("failed to close file %s", partName), err)
+	}
+
+	return partName, nil
+}
@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/compression"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/state"
+)
+
+func TestUploadResume(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		content := make([]byte, 64<<10)
+		_, _ = rand.Read(content)
+		writeFile(t, "a.bin", string(content))
+
+		r := connectTest(t, p)
+		pat := paths.System("a.bin")
+		hash, err := pat.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		objectName := r.objectName(hash)
+
+		if err := r.uploadObject(pat, hash, objectName); err != nil {
+			t.Fatal(err)
+		}
+		blob := readRemote(t, r.Backend, objectName)
+		if err := r.Backend.Remove(objectName); err != nil {
+			t.Fatal(err)
+		}
+
+		// the recorded progress claims the first half was uploaded, but the remote has other bytes there
+		half := len(blob) / 2
+		sum := sha256.Sum256(blob[:half])
+		up := state.Upload{Remote: path.Join(DirUploads, "partial"), Offset: int64(half), Sum: sum[:]}
+		if err := up.Save(hash); err != nil {
+			t.Fatal(err)
+		}
+		remoteName := path.Join(p.Remote.Path, up.Remote)
+		if err := r.Backend.MkdirAll(path.Dir(remoteName)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := r.Backend.Create(remoteName, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(bytes.Repeat([]byte{0}, half)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		err = r.uploadObject(pat, hash, objectName)
+		if _, ok := r.Backend.(inPlaceWriter); ok {
+			// the upload is resumed, but the object must not be made of the wrong bytes
+			if err == nil || !strings.Contains(err.Error(), "does not match") {
+				t.Fatalf("got %v, want the remote bytes to be rejected", err)
+			}
+			if _, err := r.Backend.Stat(objectName); !os.IsNotExist(err) {
+				t.Fatalf("object was created from the wrong bytes: %v", err)
+			}
+			return
+		}
+
+		// backends that upload on close never resume, their progress was never confirmed
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readRemote(t, r.Backend, objectName); !bytes.Equal(got, blob) {
+			t.Fatal("uploaded object differs from the first upload")
+		}
+	})
+}
+
+func TestCompressionPolicies(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		p.Compression = compression.Rules{
+			{Pattern: "*.raw", Policy: compression.Policy{Codec: compression.CodecNone}},
+			{Pattern: "*.txt", Policy: compression.Policy{Codec: compression.CodecGzip}},
+		}
+
+		newWorkTree(t)
+		content := strings.Repeat("compressible ", 1000)
+		writeFile(t, "stored.raw", content)
+		writeFile(t, "packed.txt", content+"packed")
+		writeFile(t, "auto.bin", content+"auto")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, stored := range map[string]bool{"stored.raw": true, "packed.txt": false, "auto.bin": false} {
+			hash, err := paths.System(name).Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob := readRemote(t, r.Backend, r.objectName(hash))
+			if got := bytes.Contains(blob, []byte(content)); got != stored {
+				t.Errorf("%s: got stored uncompressed %v, want %v", name, got, stored)
+			}
+		}
+
+		// reading needs no rules, every blob records its codec
+		p.Compression = nil
+		newWorkTree(t)
+		other := connectTest(t, p)
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{"stored.raw": content, "packed.txt": content + "packed", "auto.bin": content + "auto"} {
+			if got := readFile(t, name); got != want {
+				t.Errorf("%s: content differs after the round trip", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bloodmagesoftware/zet/internal/compression"
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/util"
+)
+
+// objectRef is a file version that refers to an object.
+type objectRef struct {
+	Path    paths.Unix
+	Version int
+}
+
+// Verify checks that every object is intact and referenced and every file version has its object and meta.
+// With --repair, orphaned objects are removed and missing or corrupt objects are uploaded again from matching local files.
+// It holds the push lock, so the objects of a running push are not mistaken for orphans.
+func (r *Remote) Verify(repair bool) error {
+	if r.Layout < project.Version {
+		return fmt.Errorf("remote uses the outdated layout version %d, use `%s migrate` to upgrade it", r.Layout, filepath.Base(os.Args[0]))
+	}
+
+	// a running push would show its uploaded objects as orphaned and its staged commit as missing
+	unlock, err := r.lockPush()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if repair {
+		if err := r.Recover(); err != nil {
+			return errors.Join(errors.New("failed to recover interrupted commits"), err)
+		}
+	}
+
+	var problems, repaired int
+	report := func(format string, a ...any) {
+		problems++
+		fmt.Printf(format+"\n", a...)
+	}
+
+	if options.FlagVerbose {
+		fmt.Println("checking metas and histories")
+	}
+
+	names, err := r.listRemoteNames()
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string][]objectRef)
+	for _, name := range names {
+		history, err := r.History(name)
+		if err != nil {
+			report("corrupt history of %s: %s", name, err)
+			continue
+		}
+		if len(history) == 0 {
+			continue
+		}
+
+		for _, m := range history {
+			if !m.Deleted {
+				key := r.objectIDString(m.Hash)
+				refs[key] = append(refs[key], objectRef{name, m.Version})
+			}
+		}
+
+		head := history[len(history)-1]
+		m, err := r.getRemoteMeta(name)
+		switch {
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			report("corrupt meta of %s: %s", name, err)
+		case err != nil && !head.Deleted:
+			report("missing meta of %s", name)
+		case err == nil && head.Deleted:
+			report("meta of deleted file %s", name)
+		case err == nil && !bytes.Equal(m.Hash, head.Hash):
+			report("meta of %s does not match its history", name)
+		default:
+			continue
+		}
+
+		if repair {
+			if err := r.repairMeta(name, head); err != nil {
+				return errors.Join(fmt.Errorf("failed to repair meta of %s", name), err)
+			}
+			repaired++
+		}
+	}
+
+	if options.FlagVerbose {
+		fmt.Println("checking objects")
+	}
+
+	objects, err := r.listObjects()
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	corrupt := make(map[string]error)
+	if err := util.Parallel(len(objects), options.FlagJobs, func(i int) error {
+		if err := r.verifyObject(objects[i]); err != nil {
+			mu.Lock()
+			corrupt[objects[i]] = err
+			mu.Unlock()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	existing := make(map[string]struct{}, len(objects))
+	var broken []string
+	for _, key := range objects {
+		existing[key] = struct{}{}
+
+		if _, ok := refs[key]; !ok {
+			if err, ok := corrupt[key]; ok {
+				report("orphaned object %s, it is also corrupt: %s", key, err)
+			} else {
+				report("orphaned object %s", key)
+			}
+			if repair {
+				id, _ := hex.DecodeString(key)
+				objectName := r.objectNameByID(id)
+				if err := r.Backend.Remove(objectName); err != nil && !os.IsNotExist(err) {
+					return errors.Join(fmt.Errorf("failed to remove file %s", objectName), err)
+				}
+				repaired++
+			}
+		} else if err, ok := corrupt[key]; ok {
+			report("corrupt object %s: %s", key, err)
+			broken = append(broken, key)
+		}
+	}
+	for key, rs := range refs {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		versions := make([]string, len(rs))
+		for i, ref := range rs {
+			versions[i] = fmt.Sprintf("%s version %d", ref.Path, ref.Version)
+		}
+		report("missing object %s of %s", key, strings.Join(versions, ", "))
+		broken = append(broken, key)
+	}
+	slices.Sort(broken)
+
+	if repair && len(broken) != 0 {
+		n, err := r.repairObjects(broken)
+		repaired += n
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case problems == 0:
+		fmt.Println("remote is healthy")
+		return nil
+	case repaired == problems:
+		fmt.Printf("repaired %d problems\n", repaired)
+		return nil
+	case repair:
+		return fmt.Errorf("found %d problems, %d could not be repaired", problems, problems-repaired)
+	default:
+		return fmt.Errorf("found %d problems, use --repair to fix them", problems)
+	}
+}
+
+// listObjects returns the hex encoded ids of all objects on the remote.
+func (r *Remote) listObjects() ([]string, error) {
+	var objects []string
+
+	objectsRoot := path.Join(r.Config.Remote.Path, DirObjects)
+	walker := r.Backend.Walk(objectsRoot)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if os.IsNotExist(err) && walker.Path() == objectsRoot {
+				break
+			}
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		if walker.Stat().IsDir() {
+			continue
+		}
+
+		rel, err := paths.Unix(walker.Path()).Rel(objectsRoot)
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to walk remote file system"), err)
+		}
+		objects = append(objects, path.Dir(string(rel))+path.Base(string(rel)))
+	}
+
+	return objects, nil
+}
+
+// verifyObject decrypts and decompresses the object and compares its content with the id in its name.
+func (r *Remote) verifyObject(key string) error {
+	id, err := hex.DecodeString(key)
+	if err != nil || len(id) < 2 {
+		return errors.New("name is no object id")
+	}
+	objectName := r.objectNameByID(id)
+
+	f, err := r.Backend.Open(objectName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var blob io.Reader = f
+	if r.key != nil {
+		if blob, err = r.key.NewBlobReader(f, id); err != nil {
+			return err
+		}
+	}
+
+	cr, err := compression.NewReader(blob)
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, cr); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(r.objectID(h.Sum(nil)), id) {
+		return errors.New("content does not match its hash")
+	}
+
+	return nil
+}
+
+func (r *Remote) repairMeta(name paths.Unix, head Meta) error {
+	remoteMetaName, err := r.remotePath(DirMeta, name, "")
+	if err != nil {
+		return err
+	}
+
+	if head.Deleted {
+		if err := r.Backend.Remove(remoteMetaName); err != nil && !os.IsNotExist(err) {
+			return errors.Join(fmt.Errorf("failed to remove file %s", remoteMetaName), err)
+		}
+		return nil
+	}
+
+	return r.writeRemoteJson(remoteMetaName, &head)
+}
+
+// repairObjects uploads the objects again from local files with the same content and returns how many problems were fixed.
+func (r *Remote) repairObjects(keys []string) (int, error) {
+	localFiles, err := r.localHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	type localFile struct {
+		name paths.Unix
+		hash []byte
+	}
+	byID := make(map[string]localFile, len(localFiles))
+	for name, hash := range localFiles {
+		byID[r.objectIDString(hash)] = localFile{name, hash}
+	}
+
+	repaired := 0
+	for _, key := range keys {
+		lf, ok := byID[key]
+		if !ok {
+			fmt.Printf("object %s can't be repaired, no local file has its content\n", key)
+			continue
+		}
+
+		objectName := r.objectName(lf.hash)
+		if err := r.Backend.Remove(objectName); err != nil && !os.IsNotExist(err) {
+			return repaired, errors.Join(fmt.Errorf("failed to remove file %s", objectName), err)
+		}
+		if err := r.uploadObject(lf.name.ToSystem(), lf.hash, objectName); err != nil {
+			return repaired, errors.Join(fmt.Errorf("failed to upload %s", lf.name), err)
+		}
+
+		fmt.Printf("uploaded object %s again from %s\n", key, lf.name)
+		repaired++
+	}
+
+	return repaired, nil
+}
@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"crypto/rand"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+	"github.com/bloodmagesoftware/zet/internal/project"
+)
+
+func TestVerifyDuringPush(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Verify(false); err != nil {
+			t.Fatal(err)
+		}
+
+		// a push that uploaded its object but has not written its commit yet
+		other := connectTest(t, p)
+		unlock, err := other.lockPush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, "b.txt", "b")
+		if _, err := other.pushFile(paths.System("b.txt")); err != nil {
+			unlock()
+			t.Fatal(err)
+		}
+
+		err = r.Verify(false)
+		unlock()
+		if err == nil || !strings.Contains(err.Error(), "try again later") {
+			t.Fatalf("got %v, want verify to wait for the push", err)
+		}
+	})
+}
+
+// putRemote replaces a file on the remote.
+func putRemote(t *testing.T, b Backend, name string, content []byte) {
+	t.Helper()
+
+	if err := b.MkdirAll(path.Dir(name)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := b.Create(name, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRepair(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, p project.Project) {
+		newWorkTree(t)
+		writeFile(t, "a.txt", "a")
+		writeFile(t, "b.txt", "b")
+		writeFile(t, "c.txt", "c")
+
+		r := connectTest(t, p)
+		withMessage(t, "")
+		if err := r.InitialCommit(); err != nil {
+			t.Fatal(err)
+		}
+
+		hashOf := func(name string) []byte {
+			hash, err := paths.System(name).Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return hash
+		}
+
+		// a corrupt object, a missing object, an orphaned object and a missing meta
+		putRemote(t, r.Backend, r.objectName(hashOf("a.txt")), []byte("garbage"))
+		if err := r.Backend.Remove(r.objectName(hashOf("b.txt"))); err != nil {
+			t.Fatal(err)
+		}
+		orphan := make([]byte, 32)
+		_, _ = rand.Read(orphan)
+		putRemote(t, r.Backend, r.objectNameByID(orphan), []byte("orphan"))
+		metaName, err := r.remotePath(DirMeta, paths.Unix("c.txt"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Backend.Remove(metaName); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := r.Verify(false); err == nil || !strings.Contains(err.Error(), "found 4 problems") {
+			t.Fatalf("got %v, want 4 problems", err)
+		}
+		if err := r.Verify(true); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Verify(false); err != nil {
+			t.Fatalf("remote is still damaged after repairing it: %v", err)
+		}
+		if _, err := r.Backend.Stat(r.objectNameByID(orphan)); err == nil {
+			t.Error("orphaned object was not removed")
+		}
+
+		newWorkTree(t)
+		other := connectTest(t, p)
+		if err := other.Clone(); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"} {
+			if got := readFile(t, name); got != content {
+				t.Errorf("%s: got %q, want %q", name, got, content)
+			}
+		}
+	})
+}
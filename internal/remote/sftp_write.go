@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+)
+
+// DirTemp holds remote files while they are written, so readers never see incomplete files
+const DirTemp = "tmp"
+
+// writeRemoteFile replaces the remote file name atomically with the content written by write.
+func (r *Remote) writeRemoteFile(name string, write func(w io.Writer) error) error {
+	tempName, err := r.writeTemp(r.sealing(name, write))
+	if err != nil {
+		return err
+	}
+
+	if err := r.mkdirRemote(path.Dir(name)); err != nil {
+		_ = r.Backend.Remove(tempName)
+		return err
+	}
+
+	if err := r.Backend.Rename(tempName, name); err != nil {
+		_ = r.Backend.Remove(tempName)
+		return errors.Join(fmt.Errorf("failed to move %s to %s on remote", tempName, name), err)
+	}
+
+	return nil
+}
+
+// createRemoteFile creates the remote file name atomically with the content written by write.
+// It fails with fs.ErrExist if the file already exists, so only one client can create it.
+func (r *Remote) createRemoteFile(name string, write func(w io.Writer) error) error {
+	tempName, err := r.writeTemp(r.sealing(name, write))
+	if err != nil {
+		return err
+	}
+	defer r.Backend.Remove(tempName)
+
+	if err := r.mkdirRemote(path.Dir(name)); err != nil {
+		return err
+	}
+
+	// unlike a rename, a hard link never replaces an existing file
+	if err := r.Backend.Link(tempName, name); err != nil {
+		if _, statErr := r.Backend.Stat(name); statErr == nil {
+			return errors.Join(fmt.Errorf("file %s already exists on remote", name), fs.ErrExist)
+		}
+		return errors.Join(fmt.Errorf("failed to link %s to %s on remote", tempName, name), err)
+	}
+
+	return nil
+}
+
+func (r *Remote) writeRemoteJson(name string, v any) error {
+	return r.writeRemoteFile(name, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+func (r *Remote) writeTemp(write func(w io.Writer) error) (string, error) {
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	tempName := path.Join(r.Config.Remote.Path, DirTemp, hex.EncodeToString(suffix))
+
+	if err := r.mkdirRemote(path.Dir(tempName)); err != nil {
+		return "", err
+	}
+
+	f, err := r.Backend.Create(tempName, true)
+	if err != nil {
+		return "", errors.Join(fmt.Errorf("failed to create file %s on remote", tempName), err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		_ = r.Backend.Remove(tempName)
+		return "", errors.Join(fmt.Errorf("failed to write file %s on remote", tempName), err)
+	}
+	if err := f.Close(); err != nil {
+		_ = r.Backend.Remove(tempName)
+		return "", errors.Join(fmt.Errorf("failed to close file %s on remote", tempName), err)
+	}
+
+	return tempName, nil
+}
+
+func (r *Remote) mkdirRemote(dir string) error {
+	if err := r.Backend.MkdirAll(dir); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s on remote", dir), err)
+	}
+	return nil
+}
+
+// removeStaleTemps removes temporary files left behind by interrupted writes.
+func (r *Remote) removeStaleTemps() error {
+	tempRoot := path.Join(r.Config.Remote.Path, DirTemp)
+
+	fis, err := r.Backend.ReadDir(tempRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Join(fmt.Errorf("failed to read directory %s", tempRoot), err)
+	}
+
+	for _, fi := range fis {
+		if time.Since(fi.ModTime()) <= staleStagingAge {
+			continue
+		}
+		tempName := path.Join(tempRoot, fi.Name())
+		if err := r.Backend.Remove(tempName); err != nil && !os.IsNotExist(err) {
+			return errors.Join(fmt.Errorf("failed to remove stale file %s", tempName), err)
+		}
+	}
+
+	return nil
+}
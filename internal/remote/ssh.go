@@ -1,64 +1,88 @@
 package remote
 
 import (
+	"errors"
 	"fmt"
-	"net"
-	"os/user"
-	"path/filepath"
 
-	"github.com/bloodmagesoftware/zet/internal/options"
 	"github.com/bloodmagesoftware/zet/internal/project"
-	"github.com/bloodmagesoftware/zet/internal/util"
-	"github.com/charmbracelet/huh"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
-func hostKeyCallback() ssh.HostKeyCallback {
-	if u, err := user.Current(); err == nil {
-		path := filepath.Join(u.HomeDir, ".ssh", "known_hosts")
-		if util.Exists(path) {
-			if hostKeyCallback, err := knownhosts.New(path); err == nil {
-				return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-					if options.FlagForce {
-						return nil
-					}
-					ok := false
-					if err := hostKeyCallback(hostname, remote, key); err != nil {
-						if fErr := huh.NewForm(huh.NewGroup(
-							huh.NewConfirm().
-								Title(err.Error()).
-								Value(&ok).
-								Affirmative("Allow").
-								Negative("Cancel"),
-						)).Run(); fErr == nil && ok {
-							return nil
-						}
-						return err
-					} else {
-						return nil
-					}
-				}
-			}
+func connectSsh(p project.Project) (*ssh.Client, error) {
+	host, err := resolveHost(p.Remote.Hostname, p.Remote.Username, p.Remote.Port)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to resolve host %s", p.Remote.Hostname), err)
+	}
+
+	return dialHost(host, p.Remote)
+}
+
+// dialHost connects to the host through its jump hosts.
+func dialHost(host sshHost, rem project.Remote) (*ssh.Client, error) {
+	// the credentials of the project belong to the remote host, jump hosts only get the agent and their own identity files
+	jumpRemote := project.Remote{Auth: project.AuthAgent}
+
+	var via *ssh.Client
+	for _, jump := range host.ProxyJump {
+		var err error
+		if via, err = dialSsh(via, jump, jumpRemote); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to connect to jump host %s", jump.Addr), err)
 		}
 	}
-	return ssh.InsecureIgnoreHostKey()
+
+	return dialSsh(via, host, rem)
 }
 
-func connectSsh(p project.Project) (*ssh.Client, error) {
+// dialSsh connects to the host, through the client via if it is not nil.
+// Closing the returned client also closes via.
+func dialSsh(via *ssh.Client, host sshHost, rem project.Remote) (*ssh.Client, error) {
+	auth, closeAuth := authMethods(rem, host.IdentityFiles)
+	// the agent is only needed for the handshake
+	defer closeAuth()
+	if len(auth) == 0 {
+		if via != nil {
+			_ = via.Close()
+		}
+		return nil, fmt.Errorf("no credentials available for auth method %s", rem.Auth)
+	}
+
+	hostKeyCallback, hostKeyAlgorithms, err := newHostKeyCallback(host.Addr)
+	if err != nil {
+		if via != nil {
+			_ = via.Close()
+		}
+		return nil, err
+	}
+
 	config := &ssh.ClientConfig{
-		User: p.Remote.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(p.Remote.Password),
-		},
-		HostKeyCallback: hostKeyCallback(),
+		User:              host.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
 	}
 
-	addr := fmt.Sprintf("%s:%d", p.Remote.Hostname, p.Remote.Port)
-	client, err := ssh.Dial("tcp", addr, config)
+	if via == nil {
+		return ssh.Dial("tcp", host.Addr, config)
+	}
+
+	conn, err := via.Dial("tcp", host.Addr)
 	if err != nil {
+		_ = via.Close()
+		return nil, errors.Join(fmt.Errorf("failed to dial %s", host.Addr), err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, host.Addr, config)
+	if err != nil {
+		_ = conn.Close()
+		_ = via.Close()
 		return nil, err
 	}
 
+	client := ssh.NewClient(c, chans, reqs)
+	go func() {
+		_ = client.Wait()
+		_ = via.Close()
+	}()
+
 	return client, nil
 }
@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/charmbracelet/huh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// defaultKeyNames are tried in order if no private key is configured.
+var defaultKeyNames = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// authMethods returns the configured auth method first, followed by all other available ones.
+// The SSH client tries every kind of method only once, so the signers of the agent and of the private keys
+// are offered by a single public key method, in the order of the configured auth method.
+// The returned func closes the connection to the SSH agent, call it once the client is connected.
+func authMethods(rem project.Remote, identityFiles []string) ([]ssh.AuthMethod, func()) {
+	fromAgent, closeAgent := agentSigners()
+	fromKeys := keySigners(rem, identityFiles)
+
+	var sources []func() []ssh.Signer
+	if rem.Auth == project.AuthKey {
+		sources = []func() []ssh.Signer{fromKeys, fromAgent}
+	} else {
+		sources = []func() []ssh.Signer{fromAgent, fromKeys}
+	}
+	sources = util.SlicesFilter(sources, func(f func() []ssh.Signer) bool {
+		return f != nil
+	})
+
+	var publicKeyMethod ssh.AuthMethod
+	if len(sources) != 0 {
+		publicKeyMethod = ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			var signers []ssh.Signer
+			for _, source := range sources {
+				signers = append(signers, source()...)
+			}
+			return signers, nil
+		})
+	}
+
+	var passwordMethod ssh.AuthMethod
+	if rem.Password != "" {
+		passwordMethod = ssh.Password(rem.Password)
+	}
+
+	var ordered []ssh.AuthMethod
+	switch rem.Auth {
+	case project.AuthAgent, project.AuthKey:
+		ordered = []ssh.AuthMethod{publicKeyMethod, passwordMethod}
+	default:
+		ordered = []ssh.AuthMethod{passwordMethod, publicKeyMethod}
+	}
+
+	return util.SlicesFilter(ordered, func(m ssh.AuthMethod) bool {
+		return m != nil
+	}), closeAgent
+}
+
+// agentSigners returns nil if no SSH agent is running.
+// The returned func closes the connection to the agent, it is safe to call either way.
+func agentSigners() (func() []ssh.Signer, func()) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, func() {}
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, func() {}
+	}
+
+	client := agent.NewClient(conn)
+	return func() []ssh.Signer {
+			signers, err := client.Signers()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get keys from SSH agent: %s\n", err)
+				return nil
+			}
+			return signers
+		}, func() {
+			_ = conn.Close()
+		}
+}
+
+// keySigners returns nil if there is no private key to use.
+// The configured key takes precedence over the identity files of the SSH config, which take precedence over the default keys.
+// Keys are only read once the server asks for them, so encrypted keys don't prompt for their passphrase unless they are needed.
+// Keys that can't be loaded are skipped, so the remaining keys and methods are still tried.
+func keySigners(rem project.Remote, identityFiles []string) func() []ssh.Signer {
+	if rem.KeyData != "" {
+		return func() []ssh.Signer {
+			signer, err := parseSigner(project.EnvSshKey, []byte(rem.KeyData))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping private key: %s\n", err)
+				return nil
+			}
+			return []ssh.Signer{signer}
+		}
+	}
+
+	var keyNames []string
+	if rem.Key != "" {
+		keyNames = []string{util.ExpandHome(rem.Key)}
+	} else {
+		for _, name := range identityFiles {
+			keyNames = append(keyNames, util.ExpandHome(name))
+		}
+		keyNames = util.SlicesFilter(keyNames, util.Exists)
+
+		if home, err := os.UserHomeDir(); err == nil && len(keyNames) == 0 {
+			for _, name := range defaultKeyNames {
+				keyNames = append(keyNames, filepath.Join(home, ".ssh", name))
+			}
+		}
+	}
+
+	keyNames = util.SlicesFilter(keyNames, util.Exists)
+	if len(keyNames) == 0 {
+		return nil
+	}
+
+	return func() []ssh.Signer {
+		signers := make([]ssh.Signer, 0, len(keyNames))
+		for _, name := range keyNames {
+			signer, err := loadSigner(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "skipping private key: %s\n", err)
+				continue
+			}
+			signers = append(signers, signer)
+		}
+		return signers
+	}
+}
+
+func loadSigner(keyName string) (ssh.Signer, error) {
+	b, err := os.ReadFile(keyName)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read private key %s", keyName), err)
+	}
+
+	return parseSigner(keyName, b)
+}
+
+// parseSigner parses the private key b, keyName is only used for messages.
+func parseSigner(keyName string, b []byte) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(b)
+	if err == nil {
+		return signer, nil
+	}
+
+	var passphraseErr *ssh.PassphraseMissingError
+	if !errors.As(err, &passphraseErr) {
+		return nil, errors.Join(fmt.Errorf("failed to parse private key %s", keyName), err)
+	}
+
+	if !util.IsInteractive() {
+		return nil, fmt.Errorf("private key %s is encrypted and its passphrase can't be asked without a terminal, add it to an SSH agent instead", keyName)
+	}
+
+	var passphrase string
+	if err := huh.NewForm(huh.NewGroup(
+		huh.NewInput().
+			Title(fmt.Sprintf("Passphrase for %s", keyName)).
+			EchoMode(huh.EchoModePassword).
+			Value(&passphrase),
+	)).Run(); err != nil {
+		return nil, err
+	}
+
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to decrypt private key %s", keyName), err)
+	}
+
+	return signer, nil
+}
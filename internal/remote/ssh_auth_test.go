@@ -0,0 +1,143 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// writeTestKey writes a new unencrypted private key into dir and returns its file name and public key.
+func writeTestKey(t *testing.T, dir, name string) (string, ssh.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyName := filepath.Join(dir, name)
+	if err := os.WriteFile(keyName, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyName, sshPub
+}
+
+// startKeyServer starts a test server that only accepts the public key authorized.
+func startKeyServer(t *testing.T, authorized ssh.PublicKey) string {
+	t.Helper()
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() != testUsername || !bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(startTestServer(t, config)))
+}
+
+func TestKeyAuthSkipsBrokenKeys(t *testing.T) {
+	isolateTestEnv(t)
+	dir := t.TempDir()
+
+	broken := filepath.Join(dir, "broken")
+	if err := os.WriteFile(broken, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a valid key the server does not accept
+	otherName, _ := writeTestKey(t, dir, "other")
+	goodName, good := writeTestKey(t, dir, "good")
+
+	host := sshHost{
+		Addr:          startKeyServer(t, good),
+		User:          testUsername,
+		IdentityFiles: []string{broken, otherName, goodName},
+	}
+	c, err := dialSsh(nil, host, project.Remote{Auth: project.AuthKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
+
+func TestKeyAuthAfterPassword(t *testing.T) {
+	isolateTestEnv(t)
+	goodName, good := writeTestKey(t, t.TempDir(), "good")
+
+	// the server rejects the password, so the key has to be tried next
+	host := sshHost{
+		Addr:          startKeyServer(t, good),
+		User:          testUsername,
+		IdentityFiles: []string{goodName},
+	}
+	c, err := dialSsh(nil, host, project.Remote{Auth: project.AuthPassword, Password: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
+
+func TestAgentAndKeyAuth(t *testing.T) {
+	isolateTestEnv(t)
+	dir := t.TempDir()
+
+	// the agent only has a key the server does not accept
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: otherKey}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	goodName, good := writeTestKey(t, dir, "good")
+	host := sshHost{
+		Addr:          startKeyServer(t, good),
+		User:          testUsername,
+		IdentityFiles: []string{goodName},
+	}
+	c, err := dialSsh(nil, host, project.Remote{Auth: project.AuthAgent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
@@ -0,0 +1,115 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bloodmagesoftware/zet/internal/user"
+	"github.com/kevinburke/ssh_config"
+)
+
+// sshHost is a host resolved through the SSH config of the user.
+type sshHost struct {
+	Addr          string
+	User          string
+	IdentityFiles []string
+	// ProxyJump lists the jump hosts to connect through, in order
+	ProxyJump []sshHost
+}
+
+// resolveHost looks up the host alias in ~/.ssh/config and /etc/ssh/ssh_config.
+// Values set in the project take precedence, a port of 22 counts as unset since it is the default of every project.
+func resolveHost(alias string, username string, port int) (sshHost, error) {
+	h := sshHost{}
+
+	hostname, err := sshConfigGet(alias, "HostName")
+	if err != nil {
+		return h, err
+	}
+	if hostname == "" {
+		hostname = alias
+	} else {
+		hostname = strings.ReplaceAll(hostname, "%h", alias)
+	}
+
+	if port == 0 || port == 22 {
+		portStr, err := sshConfigGet(alias, "Port")
+		if err != nil {
+			return h, err
+		}
+		if port, err = strconv.Atoi(portStr); err != nil {
+			return h, errors.Join(fmt.Errorf("failed to parse port %s of host %s in ssh config", portStr, alias), err)
+		}
+	}
+	h.Addr = net.JoinHostPort(hostname, strconv.Itoa(port))
+
+	h.User = username
+	if h.User == "" {
+		if h.User, err = sshConfigGet(alias, "User"); err != nil {
+			return h, err
+		}
+	}
+	if h.User == "" {
+		h.User = user.Name()
+	}
+
+	if h.IdentityFiles, err = ssh_config.GetAllStrict(alias, "IdentityFile"); err != nil {
+		return h, errors.Join(errors.New("failed to read ssh config"), err)
+	}
+
+	proxyJump, err := sshConfigGet(alias, "ProxyJump")
+	if err != nil {
+		return h, err
+	}
+	if proxyJump != "" && proxyJump != "none" {
+		for _, jump := range strings.Split(proxyJump, ",") {
+			jumpUser, jumpHost, jumpPort, err := parseJump(jump)
+			if err != nil {
+				return h, errors.Join(fmt.Errorf("failed to parse jump host %s of host %s in ssh config", jump, alias), err)
+			}
+			// the chain of the host replaces any jump hosts configured for the jump hosts themselves
+			jh, err := resolveHost(jumpHost, jumpUser, jumpPort)
+			if err != nil {
+				return h, err
+			}
+			jh.ProxyJump = nil
+			h.ProxyJump = append(h.ProxyJump, jh)
+		}
+	}
+
+	return h, nil
+}
+
+func sshConfigGet(alias, key string) (string, error) {
+	val, err := ssh_config.GetStrict(alias, key)
+	if err != nil {
+		return "", errors.Join(errors.New("failed to read ssh config"), err)
+	}
+	return val, nil
+}
+
+// parseJump parses a jump host in the form [user@]host[:port], a port of 0 means unset.
+func parseJump(s string) (string, string, int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "ssh://")
+
+	var username string
+	if u, rest, ok := strings.Cut(s, "@"); ok {
+		username, s = u, rest
+	}
+
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		// no port
+		return username, s, 0, nil
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return username, host, 0, errors.Join(fmt.Errorf("failed to parse port string %s to int", portStr), err)
+	}
+
+	return username, host, port, nil
+}
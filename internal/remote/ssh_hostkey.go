@@ -0,0 +1,220 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/util"
+	"github.com/charmbracelet/huh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func knownHostsName() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Join(errors.New("failed to get home directory"), err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// hostKeyAlgorithms are the host key algorithms offered to servers with known keys, in order of preference.
+var hostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA,
+}
+
+// hostKeyType returns the type of the keys that sign with the host key algorithm algo.
+func hostKeyType(algo string) string {
+	switch algo {
+	case ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256:
+		return ssh.KeyAlgoRSA
+	default:
+		return algo
+	}
+}
+
+// newHostKeyCallback verifies host keys against ~/.ssh/known_hosts.
+// Unknown hosts are trusted on first use after the user accepted the fingerprint, changed keys are rejected unless --accept-new-hostkey is used.
+// It also returns the host key algorithms to offer to addr, those of the keys known for it come first,
+// otherwise the server may prove itself with a key of another type that is not known yet.
+func newHostKeyCallback(addr string) (ssh.HostKeyCallback, []string, error) {
+	name, err := knownHostsName()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil && !os.IsExist(err) {
+		return nil, nil, errors.Join(fmt.Errorf("failed to make directory %s", filepath.Dir(name)), err)
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("failed to open file %s", name), err)
+	}
+	_ = f.Close()
+
+	knownHostsCallback, err := knownhosts.New(name)
+	if err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("failed to read known hosts from %s", name), err)
+	}
+
+	algorithms, err := knownHostKeyAlgorithms(knownHostsCallback, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := knownHostsCallback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		// only a known key of the same type was changed, a key of another type is just not known yet
+		var replaced []knownhosts.KnownKey
+		for _, k := range keyErr.Want {
+			if k.Key.Type() == key.Type() {
+				replaced = append(replaced, k)
+			}
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		if len(replaced) != 0 {
+			if !options.FlagAcceptNewHostKey {
+				return fmt.Errorf("host key of %s changed to %s %s, this could be a man-in-the-middle attack\nif the key was changed on purpose, use --accept-new-hostkey to replace it in %s",
+					hostname, key.Type(), fingerprint, name)
+			}
+			if err := removeKnownHosts(name, replaced); err != nil {
+				return err
+			}
+		} else if !options.FlagAcceptNewHostKey {
+			if !util.IsInteractive() {
+				return fmt.Errorf("host %s is unknown and its %s key %s can't be confirmed without a terminal, use --accept-new-hostkey to trust it", hostname, key.Type(), fingerprint)
+			}
+			ok := false
+			if err := huh.NewForm(huh.NewGroup(
+				huh.NewConfirm().
+					Title(fmt.Sprintf("The authenticity of host %s can't be established", hostname)).
+					Description(fmt.Sprintf("%s key fingerprint is %s", key.Type(), fingerprint)).
+					Value(&ok).
+					Affirmative("Trust").
+					Negative("Cancel"),
+			)).Run(); err != nil {
+				return errors.Join(fmt.Errorf("failed to confirm host key of %s", hostname), err)
+			}
+			if !ok {
+				return fmt.Errorf("host key %s of %s was not trusted", fingerprint, hostname)
+			}
+		}
+
+		if err := appendKnownHost(name, hostname, remote, key); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "added %s key %s of %s to %s\n", key.Type(), fingerprint, hostname, name)
+
+		return nil
+	}, algorithms, nil
+}
+
+// knownHostKeyAlgorithms returns hostKeyAlgorithms with those of the keys known for addr first, nil if no key is known.
+func knownHostKeyAlgorithms(knownHostsCallback ssh.HostKeyCallback, addr string) ([]string, error) {
+	// a key that is never known makes the callback list the keys it knows for the host
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := knownHostsCallback(addr, &net.TCPAddr{}, probe); !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(keyErr.Want))
+	for _, k := range keyErr.Want {
+		known[k.Key.Type()] = true
+	}
+
+	algorithms := make([]string, 0, len(hostKeyAlgorithms))
+	for _, algo := range hostKeyAlgorithms {
+		if known[hostKeyType(algo)] {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	for _, algo := range hostKeyAlgorithms {
+		if !known[hostKeyType(algo)] {
+			algorithms = append(algorithms, algo)
+		}
+	}
+	return algorithms, nil
+}
+
+func appendKnownHost(name string, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil {
+		if addr := knownhosts.Normalize(remote.String()); addr != addresses[0] {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to open file %s", name), err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintln(f, knownhosts.Line(addresses, key)); err != nil {
+		return errors.Join(fmt.Errorf("failed to write file %s", name), err)
+	}
+
+	return nil
+}
+
+// removeKnownHosts removes the lines of the replaced keys so they are no longer trusted.
+func removeKnownHosts(name string, keys []knownhosts.KnownKey) error {
+	lines := make(map[string][]int)
+	for _, k := range keys {
+		lines[k.Filename] = append(lines[k.Filename], k.Line)
+	}
+
+	for filename, remove := range lines {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			return errors.Join(fmt.Errorf("failed to read file %s", filename), err)
+		}
+
+		var sb strings.Builder
+		sc := bufio.NewScanner(strings.NewReader(string(b)))
+		for line := 1; sc.Scan(); line++ {
+			if slices.Contains(remove, line) {
+				continue
+			}
+			sb.WriteString(sc.Text())
+			sb.WriteByte('\n')
+		}
+
+		if err := os.WriteFile(filename, []byte(sb.String()), 0600); err != nil {
+			return errors.Join(fmt.Errorf("failed to write file %s", filename), err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/options"
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startHostKeyServer starts a test server with an ed25519 and an ECDSA host key and returns its address and the ed25519 key.
+func startHostKeyServer(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() != testUsername || string(password) != testPassword {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	edSigner, err := ssh.NewSignerFromKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSigner, err := ssh.NewSignerFromKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(edSigner)
+	config.AddHostKey(ecSigner)
+
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(serveTestServer(t, config))), edSigner.PublicKey()
+}
+
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	name, err := knownHostsName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestHostKeyOtherAlgorithm(t *testing.T) {
+	isolateTestEnv(t)
+	options.FlagAcceptNewHostKey = false
+
+	// OpenSSH recorded the ed25519 key, while the client prefers ECDSA if it has no known keys
+	addr, edKey := startHostKeyServer(t)
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, edKey)
+	name := writeKnownHosts(t, line)
+
+	c, err := dialSsh(nil, sshHost{Addr: addr, User: testUsername}, project.Remote{Auth: project.AuthPassword, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+
+	if b, err := os.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(b) != line+"\n" {
+		t.Fatalf("known hosts changed to %q", b)
+	}
+}
+
+func TestHostKeyUnknownType(t *testing.T) {
+	isolateTestEnv(t)
+
+	// a known key of a type the server does not offer did not change, accepting the new key must keep it
+	addr, edKey := startHostKeyServer(t)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := ssh.NewPublicKey(&otherKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLine := knownhosts.Line([]string{knownhosts.Normalize(addr)}, otherPub)
+	name := writeKnownHosts(t, otherLine)
+
+	c, err := dialSsh(nil, sshHost{Addr: addr, User: testUsername}, project.Remote{Auth: project.AuthPassword, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+
+	// ed25519 is preferred over ECDSA when no offered type is known
+	want := otherLine + "\n" + knownhosts.Line([]string{knownhosts.Normalize(addr)}, edKey) + "\n"
+	if b, err := os.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(b) != want {
+		t.Fatalf("known hosts are %q, want %q", b, want)
+	}
+}
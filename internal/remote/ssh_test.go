@@ -0,0 +1,47 @@
+package remote
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProxyJumpCredentials(t *testing.T) {
+	p := newSftpTestProject(t)
+
+	// the jump host only knows the default key of the user
+	sshDir := filepath.Join(os.Getenv("HOME"), ".ssh")
+	if err := os.Mkdir(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	_, jumpKey := writeTestKey(t, sshDir, "id_ed25519")
+	jumpConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() != "jump" || !bytes.Equal(key.Marshal(), jumpKey.Marshal()) {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			t.Error("the password of the remote was sent to the jump host")
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	jumpAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(startTestServer(t, jumpConfig)))
+
+	host := sshHost{
+		Addr:      net.JoinHostPort(p.Remote.Hostname, strconv.Itoa(p.Remote.Port)),
+		User:      p.Remote.Username,
+		ProxyJump: []sshHost{{Addr: jumpAddr, User: "jump"}},
+	}
+	c, err := dialHost(host, p.Remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Close()
+}
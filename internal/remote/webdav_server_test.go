@@ -0,0 +1,116 @@
+package remote
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bloodmagesoftware/zet/internal/project"
+	"golang.org/x/net/webdav"
+)
+
+// webdavTestPrefix is where the test server serves WebDAV, like the path of a Nextcloud user.
+const webdavTestPrefix = "/remote.php/dav/files/zet"
+
+// fakeWebdav wraps the WebDAV handler of x/net with the parts of real servers that it lacks.
+type fakeWebdav struct {
+	handler *webdav.Handler
+	dir     string
+	// putMu makes checking If-None-Match and writing the file atomic
+	putMu sync.Mutex
+
+	// chunked sends file contents without a length, like servers that compress or stream them
+	chunked bool
+}
+
+// newWebdavTestProject starts a WebDAV server and returns a project whose remote is an empty directory on it.
+// The server serves the local file system, so tests can look at the remote directory directly.
+func newWebdavTestProject(t *testing.T) project.Project {
+	t.Helper()
+
+	p, _ := newWebdavTestProjectWith(t)
+	return p
+}
+
+// newWebdavTestProjectWith is newWebdavTestProject that also returns the fake server, so tests can change its behavior.
+func newWebdavTestProjectWith(t *testing.T) (project.Project, *fakeWebdav) {
+	t.Helper()
+
+	isolateTestEnv(t)
+
+	dir := t.TempDir()
+	fake := &fakeWebdav{
+		handler: &webdav.Handler{
+			Prefix:     webdavTestPrefix,
+			FileSystem: webdav.Dir(dir),
+			LockSystem: webdav.NewMemLS(),
+		},
+		dir: dir,
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	rem, err := project.ParseRemote(srv.URL + webdavTestPrefix + "/remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rem.Username = testUsername
+	rem.Password = testPassword
+
+	return project.Project{Version: project.Version, Remote: rem}, fake
+}
+
+func (f *fakeWebdav) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if username, password, ok := r.BasicAuth(); !ok || username != testUsername || password != testPassword {
+		w.Header().Set("WWW-Authenticate", `Basic realm="zet"`)
+		http.Error(w, "wrong username or password", http.StatusUnauthorized)
+		return
+	}
+
+	// the handler ignores If-None-Match, which real servers support for PUT
+	if r.Method == http.MethodPut && r.Header.Get("If-None-Match") == "*" {
+		f.putMu.Lock()
+		defer f.putMu.Unlock()
+
+		name := filepath.Join(f.dir, filepath.FromSlash(strings.TrimPrefix(r.URL.Path, webdavTestPrefix)))
+		if _, err := os.Stat(name); err == nil {
+			http.Error(w, "file exists", http.StatusPreconditionFailed)
+			return
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if f.chunked && r.Method == http.MethodGet {
+		w = chunkedResponseWriter{w}
+	}
+
+	f.handler.ServeHTTP(w, r)
+}
+
+// chunkedResponseWriter drops the length of the response, so it is sent chunked.
+type chunkedResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w chunkedResponseWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write flushes right away, otherwise the server adds the length to short responses itself.
+func (w chunkedResponseWriter) Write(p []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	n, err := w.ResponseWriter.Write(p)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,68 @@
+package state
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+)
+
+// racyAge is how long a file has to be left untouched before its hash is cached.
+// Changes within the timestamp granularity of the file system would not change the modification time.
+const racyAge = 2 * time.Second
+
+type (
+	// Index caches the hashes of local files so unchanged files don't have to be read again.
+	Index map[paths.Unix]IndexEntry
+
+	IndexEntry struct {
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"mod_time"`
+		Hash    []byte    `json:"hash"`
+	}
+)
+
+func LoadIndex() (Index, error) {
+	i := Index{}
+	return i, readJson(filepath.Join(Dir, FileIndex), &i)
+}
+
+func (i Index) Save() error {
+	return writeJson(filepath.Join(Dir, FileIndex), i)
+}
+
+// Hash returns the hash of a file, only reading it if it changed since it was indexed.
+func (i Index) Hash(sysPath paths.System, fi fs.FileInfo) ([]byte, error) {
+	unixPath := sysPath.ToUnix()
+
+	if ie, ok := i[unixPath]; ok && ie.Size == fi.Size() && ie.ModTime.Equal(fi.ModTime()) {
+		return ie.Hash, nil
+	}
+
+	h, err := sysPath.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(fi.ModTime()) > racyAge {
+		i[unixPath] = IndexEntry{
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			Hash:    h,
+		}
+	} else {
+		delete(i, unixPath)
+	}
+
+	return h, nil
+}
+
+// Prune removes the entries of files that no longer exist.
+func (i Index) Prune(existing map[paths.Unix][]byte) {
+	for unixPath := range i {
+		if _, ok := existing[unixPath]; !ok {
+			delete(i, unixPath)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bloodmagesoftware/zet/internal/paths"
+)
+
+const (
+	Dir       = ".zet"
+	FileBase  = "base.json"
+	FileIndex = "index.json"
+	// DirTransfers holds the progress of interrupted transfers
+	DirTransfers = "transfers"
+)
+
+// Base holds the hash every file had when it was last pushed or pulled.
+type Base map[paths.Unix][]byte
+
+func LoadBase() (Base, error) {
+	b := Base{}
+	return b, readJson(filepath.Join(Dir, FileBase), &b)
+}
+
+func (b Base) Save() error {
+	return writeJson(filepath.Join(Dir, FileBase), b)
+}
+
+// readJson leaves v untouched if the file does not exist.
+func readJson(name string, v any) error {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Join(fmt.Errorf("failed to open file %s", name), err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return errors.Join(fmt.Errorf("failed to decode file %s", name), err)
+	}
+
+	return nil
+}
+
+// writeJson replaces the file atomically so an interrupted write never corrupts the state.
+func writeJson(name string, v any) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil && !os.IsExist(err) {
+		return errors.Join(fmt.Errorf("failed to make directory %s", dir), err)
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to create temporary file in %s", dir), err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := json.NewEncoder(f).Encode(v); err != nil {
+		return errors.Join(fmt.Errorf("failed to encode file %s", name), err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Join(fmt.Errorf("failed to close file %s", f.Name()), err)
+	}
+
+	if err := os.Rename(f.Name(), name); err != nil {
+		return errors.Join(fmt.Errorf("failed to move %s to %s", f.Name(), name), err)
+	}
+
+	return nil
+}
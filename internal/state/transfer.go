@@ -0,0 +1,57 @@
+package state
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Upload is the progress of an upload, everything before Offset was confirmed by the remote.
+type Upload struct {
+	// Remote is the temporary name of the upload, relative to the remote path
+	Remote string `json:"remote"`
+	Offset int64  `json:"offset"`
+	// Sum is the hash of the uploaded bytes up to Offset
+	Sum []byte `json:"sum"`
+	// Salt is the salt of the encrypted blob, a resumed upload has to encrypt with the same one
+	Salt []byte `json:"salt,omitempty"`
+}
+
+func uploadName(hash []byte) string {
+	return filepath.Join(Dir, DirTransfers, hex.EncodeToString(hash)+".json")
+}
+
+// LoadUpload returns the progress of an interrupted upload of the content with the given hash, nil if there is none.
+func LoadUpload(hash []byte) (*Upload, error) {
+	u := &Upload{}
+	if err := readJson(uploadName(hash), u); err != nil {
+		return nil, err
+	}
+	if u.Remote == "" {
+		return nil, nil
+	}
+	return u, nil
+}
+
+func (u Upload) Save(hash []byte) error {
+	return writeJson(uploadName(hash), u)
+}
+
+func RemoveUpload(hash []byte) error {
+	name := uploadName(hash)
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return errors.Join(fmt.Errorf("failed to remove file %s", name), err)
+	}
+	return nil
+}
+
+// DownloadName returns the name of the partial download of the content with the given hash.
+func DownloadName(hash []byte) (string, error) {
+	dir := filepath.Join(Dir, DirTransfers)
+	if err := os.MkdirAll(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", errors.Join(fmt.Errorf("failed to make directory %s", dir), err)
+	}
+	return filepath.Join(dir, hex.EncodeToString(hash)+".part"), nil
+}
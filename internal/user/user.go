@@ -2,6 +2,7 @@ package user
 
 import (
 	"fmt"
+	"os"
 	"os/user"
 )
 
@@ -17,3 +18,11 @@ func Name() string {
 	}
 	return u.Username
 }
+
+func Host() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
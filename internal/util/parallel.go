@@ -0,0 +1,43 @@
+package util
+
+import (
+	"errors"
+	"sync"
+)
+
+// Parallel calls fn for every index in [0, n) using at most jobs goroutines.
+// It does not stop on the first failure, all errors are joined.
+func Parallel(n int, jobs int, fn func(i int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	indices := make(chan int)
+	for range min(jobs, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range n {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
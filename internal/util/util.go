@@ -1,6 +1,12 @@
 package util
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
 
 func Exists(name string) bool {
 	_, err := os.Stat(name)
@@ -16,3 +22,19 @@ func SlicesFilter[T any](v []T, filter func(T) bool) []T {
 	}
 	return nv
 }
+
+// IsInteractive reports if stdin is a terminal, so forms can ask the user for input.
+func IsInteractive() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
+// ExpandHome replaces a leading ~/ with the home directory of the user.
+func ExpandHome(name string) string {
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return name
+}